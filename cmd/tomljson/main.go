@@ -62,7 +62,7 @@ func reader(r io.Reader) (string, error) {
 }
 
 func mapToJSON(tree *toml.Tree) (string, error) {
-	treeMap := tree.ToMap()
+	treeMap := toml.ToJSONCompatible(tree.ToMap())
 	bytes, err := json.MarshalIndent(treeMap, "", "  ")
 	if err != nil {
 		return "", err
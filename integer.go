@@ -0,0 +1,49 @@
+package toml
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Integer is a TOML integer along with the radix it is written in, so that
+// hexadecimal, octal and binary integers keep their form when re-encoded.
+//
+// Decoding an integer into an Integer field records its radix if the decoder
+// is set up with KeepIntegerRadix, and radix 10 otherwise. Integer values are
+// encoded in their radix.
+type Integer struct {
+	Value int64
+	Radix int // 2, 8, 10 or 16
+}
+
+// String returns the TOML representation of the integer in its radix.
+// Negative integers, which TOML only allows in decimal, and unsupported
+// radixes are written in decimal.
+func (i Integer) String() string {
+	if i.Value >= 0 {
+		switch i.Radix {
+		case 16:
+			return "0x" + strings.ToUpper(strconv.FormatInt(i.Value, 16))
+		case 8:
+			return "0o" + strconv.FormatInt(i.Value, 8)
+		case 2:
+			return "0b" + strconv.FormatInt(i.Value, 2)
+		}
+	}
+	return strconv.FormatInt(i.Value, 10)
+}
+
+// Returns the radix of an integer token, from its prefix
+func integerRadix(token string) int {
+	if len(token) >= 2 && token[0] == '0' {
+		switch token[1] {
+		case 'x':
+			return 16
+		case 'o':
+			return 8
+		case 'b':
+			return 2
+		}
+	}
+	return 10
+}
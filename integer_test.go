@@ -0,0 +1,85 @@
+package toml
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestIntegerString(t *testing.T) {
+	for _, test := range []struct {
+		integer  Integer
+		expected string
+	}{
+		{Integer{255, 16}, "0xFF"},
+		{Integer{493, 8}, "0o755"},
+		{Integer{10, 2}, "0b1010"},
+		{Integer{42, 10}, "42"},
+		{Integer{42, 0}, "42"},
+		{Integer{-255, 16}, "-255"},
+	} {
+		if got := test.integer.String(); got != test.expected {
+			t.Errorf("%#v: expected %s, got %s", test.integer, test.expected, got)
+		}
+	}
+}
+
+type radixConfig struct {
+	Mask  Integer `toml:"mask"`
+	Mode  Integer `toml:"mode"`
+	Flags Integer `toml:"flags"`
+	Count Integer `toml:"count"`
+	Size  int     `toml:"size"`
+}
+
+func TestIntegerRadixRoundTrip(t *testing.T) {
+	doc := "count = 42\nflags = 0b1010\nmask = 0xFF\nmode = 0o755\nsize = 0x10\n"
+	result := radixConfig{}
+	if err := NewDecoder(strings.NewReader(doc)).KeepIntegerRadix(true).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expected := radixConfig{
+		Mask:  Integer{255, 16},
+		Mode:  Integer{493, 8},
+		Flags: Integer{10, 2},
+		Count: Integer{42, 10},
+		Size:  16,
+	}
+	if result != expected {
+		t.Errorf("Bad decode: expected %+v, got %+v", expected, result)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(result); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "count = 42\nflags = 0b1010\nmask = 0xFF\nmode = 0o755\nsize = 16\n" {
+		t.Errorf("Bad encoding:\n%s", buf.String())
+	}
+
+	var generic map[string]interface{}
+	if err := NewDecoder(strings.NewReader(doc)).KeepIntegerRadix(true).Decode(&generic); err != nil {
+		t.Fatal(err)
+	}
+	if generic["mask"] != (Integer{255, 16}) {
+		t.Errorf("expected an Integer in an interface{}, got %#v", generic["mask"])
+	}
+	tree, err := TreeFromMap(generic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(tree.String(), "mask = 0xFF\n") {
+		t.Errorf("Bad tree output:\n%s", tree.String())
+	}
+
+	result = radixConfig{}
+	if err := NewDecoder(strings.NewReader(doc)).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Mask != (Integer{255, 10}) {
+		t.Errorf("expected a decimal Integer by default, got %+v", result.Mask)
+	}
+	if result.Size != 16 {
+		t.Errorf("expected size 16, got %v", result.Size)
+	}
+}
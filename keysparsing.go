@@ -5,9 +5,32 @@ package toml
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
+// CanonicalKey joins key segments into a valid TOML dotted key, quoting the
+// segments that cannot be written as bare keys. It is the inverse of splitting
+// a key on its dots, e.g. []string{"server", "tls.cert"} gives
+// `server."tls.cert"`.
+func CanonicalKey(segments []string) string {
+	quoted := make([]string, len(segments))
+	for i, segment := range segments {
+		quoted[i] = quoteKeyIfNeeded(segment)
+	}
+	return strings.Join(quoted, ".")
+}
+
+// SplitKeyPath splits a dotted key, such as `a."b.c".d`, into its segments,
+// here []string{"a", "b.c", "d"}. Segments may be bare, quoted or literal
+// keys, and whitespace around the dots is ignored. Escape sequences in quoted
+// segments are kept as is. It is the inverse of CanonicalKey for segments
+// which do not need escaping.
+func SplitKeyPath(s string) ([]string, error) {
+	return parseKey(s)
+}
+
 // Convert the bare key group string to an array.
 // The input supports double quotation and single quotation,
 // but escape sequences are not supported. Lexers must unescape them beforehand.
@@ -109,5 +132,10 @@ func parseKey(key string) ([]string, error) {
 }
 
 func isValidBareChar(r rune) bool {
-	return isAlphanumeric(r) || r == '-' || unicode.IsNumber(r)
+	// fast path for ASCII, which the unicode functions are slow to handle
+	if r < utf8.RuneSelf {
+		return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' ||
+			'0' <= r && r <= '9' || r == '_' || r == '-'
+	}
+	return isAlphanumeric(r) || unicode.IsNumber(r)
 }
@@ -2,7 +2,10 @@ package toml
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"unicode"
 )
 
 func testResult(t *testing.T, key string, expected []string) {
@@ -77,3 +80,99 @@ func TestEmptyKey(t *testing.T) {
 	testError(t, ` `, "empty key")
 	testResult(t, `""`, []string{""})
 }
+
+func TestCanonicalKey(t *testing.T) {
+	for _, test := range []struct {
+		segments []string
+		expected string
+		escaped  bool // the parser does not support escapes in keys yet
+	}{
+		{[]string{"server", "port"}, "server.port", false},
+		{[]string{"server", "tls.cert"}, `server."tls.cert"`, false},
+		{[]string{`say "hi"`}, `"say \"hi\""`, true},
+		{[]string{"a b", ""}, `"a b".""`, false},
+	} {
+		key := CanonicalKey(test.segments)
+		if key != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.segments, test.expected, key)
+			continue
+		}
+		if test.escaped {
+			continue
+		}
+		tree, err := Load(key + " = 1")
+		if err != nil {
+			t.Errorf("%s: %s", key, err)
+			continue
+		}
+		if v := tree.GetPath(test.segments); v != int64(1) {
+			t.Errorf("%s: expected the value at %q, got %v", key, test.segments, v)
+		}
+	}
+}
+
+func TestSplitKeyPath(t *testing.T) {
+	for _, test := range []struct {
+		path     string
+		expected []string
+	}{
+		{"server.port", []string{"server", "port"}},
+		{`a."b.c".d`, []string{"a", "b.c", "d"}},
+		{`a.'b "c"'.d`, []string{"a", `b "c"`, "d"}},
+		{` a . 'C:\dir' `, []string{"a", `C:\dir`}},
+	} {
+		segments, err := SplitKeyPath(test.path)
+		if err != nil {
+			t.Errorf("%s: %s", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(segments, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.path, test.expected, segments)
+		}
+		if test.path == `a."b.c".d` && CanonicalKey(segments) != test.path {
+			t.Errorf("%s: expected CanonicalKey to give the path back, got %s", test.path, CanonicalKey(segments))
+		}
+	}
+
+	for path, expected := range map[string]string{
+		"":     "empty key",
+		"a..b": "expecting key part after dot",
+		`a."b`: "unclosed double-quoted key",
+		"a b":  "invalid key character after whitespace: b",
+	} {
+		if _, err := SplitKeyPath(path); err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", path, expected, err)
+		}
+	}
+}
+
+func TestIsValidBareChar(t *testing.T) {
+	reference := func(r rune) bool {
+		return unicode.IsLetter(r) || r == '_' || r == '-' || unicode.IsNumber(r)
+	}
+	for r := rune(0); r <= unicode.MaxRune; r++ {
+		if isValidBareChar(r) != reference(r) {
+			t.Fatalf("isValidBareChar(%U) = %v", r, isValidBareChar(r))
+		}
+	}
+	if !isValidBareChar('é') || !isValidBareChar('٣') {
+		t.Error("unicode letters and digits should be valid bare characters")
+	}
+}
+
+func BenchmarkParseKeys(b *testing.B) {
+	var buf strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&buf, "[section_%d.sub-table]\n", i)
+		for j := 0; j < 10; j++ {
+			fmt.Fprintf(&buf, "key_%d.nested-%d.value_%d = %d\n", j, j, j, j)
+		}
+	}
+	doc := buf.String()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Load(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
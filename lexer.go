@@ -12,9 +12,14 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 var dateRegexp *regexp.Regexp
+var localDateTimeRegexp *regexp.Regexp
+var localDateRegexp *regexp.Regexp
+var localTimeRegexp *regexp.Regexp
+var errUnclosedString = errors.New("unclosed string")
 
 // Define state functions
 type tomlLexStateFn func() tomlLexStateFn
@@ -25,12 +30,20 @@ type tomlLexer struct {
 	input             []rune // Textual source
 	currentTokenStart int
 	currentTokenStop  int
-	tokens            []token
-	depth             int
-	line              int
-	col               int
-	endbufferLine     int
-	endbufferCol      int
+	// byte offsets of currentTokenStart and currentTokenStop in the source
+	currentTokenStartByte int
+	currentTokenStopByte  int
+	tokens                []token
+	spans                 []Span // source span of each token
+	comments              []lexedComment
+	depth                 int
+	brackets              []rune // open brackets and braces of the value, innermost last
+	disallowTabs          bool   // reject tabs in indentation
+	headerEnded           bool   // a table header ended on the current line
+	line                  int
+	col                   int
+	endbufferLine         int
+	endbufferCol          int
 }
 
 // Basic read operations on input
@@ -52,12 +65,14 @@ func (l *tomlLexer) next() rune {
 
 	if r != eof {
 		l.currentTokenStop++
+		l.currentTokenStopByte += utf8.RuneLen(r)
 	}
 	return r
 }
 
 func (l *tomlLexer) ignore() {
 	l.currentTokenStart = l.currentTokenStop
+	l.currentTokenStartByte = l.currentTokenStopByte
 	l.line = l.endbufferLine
 	l.col = l.endbufferCol
 }
@@ -79,9 +94,16 @@ func (l *tomlLexer) emitWithValue(t tokenType, value string) {
 		typ:      t,
 		val:      value,
 	})
+	l.spans = append(l.spans, Span{Start: l.currentTokenStartByte, End: l.currentTokenStopByte})
 	l.ignore()
 }
 
+// extends the span of the last emitted token up to the current position, to
+// include delimiters consumed after emitting it
+func (l *tomlLexer) extendLastTokenSpan(start int) {
+	l.spans[len(l.spans)-1] = Span{Start: start, End: l.currentTokenStopByte}
+}
+
 func (l *tomlLexer) emit(t tokenType) {
 	l.emitWithValue(t, string(l.input[l.currentTokenStart:l.currentTokenStop]))
 }
@@ -106,14 +128,45 @@ func (l *tomlLexer) follow(next string) bool {
 	return next == l.peekString(len(next))
 }
 
+// returns the longest string of characters which may be part of a date-time,
+// whose fractional seconds may have any number of digits
+func (l *tomlLexer) peekDateTime() string {
+	end := l.inputIdx
+	for end < len(l.input) && isDateTimeChar(l.input[end]) {
+		end++
+	}
+	return string(l.input[l.inputIdx:end])
+}
+
+// reports whether r is a tab indenting a line while tabs are disallowed
+func (l *tomlLexer) isTabIndentation(r rune) bool {
+	if r != '\t' || !l.disallowTabs {
+		return false
+	}
+	for i := l.inputIdx - 1; i >= 0; i-- {
+		if l.input[i] == '\n' {
+			return true
+		}
+		if !isSpace(l.input[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 // Error management
 
 func (l *tomlLexer) errorf(format string, args ...interface{}) tomlLexStateFn {
+	return l.errorfAt(Position{l.line, l.col}, format, args...)
+}
+
+func (l *tomlLexer) errorfAt(pos Position, format string, args ...interface{}) tomlLexStateFn {
 	l.tokens = append(l.tokens, token{
-		Position: Position{l.line, l.col},
+		Position: pos,
 		typ:      tokenError,
 		val:      fmt.Sprintf(format, args...),
 	})
+	l.spans = append(l.spans, Span{Start: l.currentTokenStartByte, End: l.currentTokenStopByte})
 	return nil
 }
 
@@ -122,6 +175,9 @@ func (l *tomlLexer) errorf(format string, args ...interface{}) tomlLexStateFn {
 func (l *tomlLexer) lexVoid() tomlLexStateFn {
 	for {
 		next := l.peek()
+		if l.headerEnded && !endsLine(next) {
+			return l.errorf("a table header must be followed by a newline")
+		}
 		switch next {
 		case '[':
 			return l.lexTableKey
@@ -132,11 +188,18 @@ func (l *tomlLexer) lexVoid() tomlLexStateFn {
 		case '\r':
 			fallthrough
 		case '\n':
+			if l.inInlineTable() {
+				return l.errorf("newlines are not allowed in inline tables")
+			}
 			l.skip()
+			l.headerEnded = false
 			continue
 		}
 
 		if isSpace(next) {
+			if l.isTabIndentation(next) {
+				return l.errorf("tabs are not allowed in indentation")
+			}
 			l.skip()
 		}
 
@@ -161,6 +224,9 @@ func (l *tomlLexer) lexVoid() tomlLexStateFn {
 func (l *tomlLexer) lexRvalue() tomlLexStateFn {
 	for {
 		next := l.peek()
+		if len(l.brackets) == 0 && l.followsValue() && !endsLine(next) {
+			return l.errorf("a key/value pair must be followed by a newline")
+		}
 		switch next {
 		case '.':
 			return l.errorf("cannot start float with a dot")
@@ -168,13 +234,17 @@ func (l *tomlLexer) lexRvalue() tomlLexStateFn {
 			return l.lexEqual
 		case '[':
 			l.depth++
+			l.brackets = append(l.brackets, next)
 			return l.lexLeftBracket
 		case ']':
 			l.depth--
+			l.popBracket()
 			return l.lexRightBracket
 		case '{':
+			l.brackets = append(l.brackets, next)
 			return l.lexLeftCurlyBrace
 		case '}':
+			l.popBracket()
 			return l.lexRightCurlyBrace
 		case '#':
 			return l.lexComment(l.lexRvalue)
@@ -187,6 +257,9 @@ func (l *tomlLexer) lexRvalue() tomlLexStateFn {
 		case '\r':
 			fallthrough
 		case '\n':
+			if l.inInlineTable() {
+				return l.errorf("newlines are not allowed in inline tables")
+			}
 			l.skip()
 			if l.depth == 0 {
 				return l.lexVoid
@@ -196,11 +269,13 @@ func (l *tomlLexer) lexRvalue() tomlLexStateFn {
 			return l.errorf("cannot start number with underscore")
 		}
 
-		if l.follow("true") {
+		// booleans are matched regardless of case in value position, the
+		// parser rejects the ones which are not lowercase unless asked not to
+		if l.followBoolean("true") {
 			return l.lexTrue
 		}
 
-		if l.follow("false") {
+		if l.followBoolean("false") {
 			return l.lexFalse
 		}
 
@@ -213,6 +288,9 @@ func (l *tomlLexer) lexRvalue() tomlLexStateFn {
 		}
 
 		if isSpace(next) {
+			if l.isTabIndentation(next) {
+				return l.errorf("tabs are not allowed in indentation")
+			}
 			l.skip()
 			continue
 		}
@@ -222,17 +300,20 @@ func (l *tomlLexer) lexRvalue() tomlLexStateFn {
 			break
 		}
 
-		possibleDate := l.peekString(35)
-		dateMatch := dateRegexp.FindString(possibleDate)
-		if dateMatch != "" {
+		possibleDate := l.peekDateTime()
+		if typ, dateMatch := matchDateTime(possibleDate); dateMatch != "" {
 			l.fastForward(len(dateMatch))
-			return l.lexDate
+			return l.lexDate(typ)
 		}
 
 		if next == '+' || next == '-' || isDigit(next) {
 			return l.lexNumber
 		}
 
+		if l.expectsValue() && l.followMiscasedSpecialFloat() {
+			return l.errorf("inf and nan must be lowercase, got %s", l.peekString(3))
+		}
+
 		if isAlphanumeric(next) {
 			return l.lexKey
 		}
@@ -244,6 +325,37 @@ func (l *tomlLexer) lexRvalue() tomlLexStateFn {
 	return nil
 }
 
+// reports whether the last token is a complete value, once the brackets and
+// braces of arrays and inline tables are closed
+func (l *tomlLexer) followsValue() bool {
+	if len(l.tokens) == 0 {
+		return false
+	}
+	switch l.tokens[len(l.tokens)-1].typ {
+	case tokenString, tokenInteger, tokenTrue, tokenFalse, tokenFloat, tokenInf, tokenNan,
+		tokenRightBracket, tokenRightCurlyBrace,
+		tokenDate, tokenLocalDate, tokenLocalTime, tokenLocalDateTime:
+		return true
+	}
+	return false
+}
+
+// reports whether r may follow a key/value pair or a table header on its line
+func endsLine(r rune) bool {
+	return isSpace(r) || r == '#' || r == '\r' || r == '\n' || r == eof
+}
+
+// reports whether the innermost bracket of the value is an inline table's
+func (l *tomlLexer) inInlineTable() bool {
+	return len(l.brackets) > 0 && l.brackets[len(l.brackets)-1] == '{'
+}
+
+func (l *tomlLexer) popBracket() {
+	if len(l.brackets) > 0 {
+		l.brackets = l.brackets[:len(l.brackets)-1]
+	}
+}
+
 func (l *tomlLexer) lexLeftCurlyBrace() tomlLexStateFn {
 	l.next()
 	l.emit(tokenLeftCurlyBrace)
@@ -256,35 +368,120 @@ func (l *tomlLexer) lexRightCurlyBrace() tomlLexStateFn {
 	return l.lexRvalue
 }
 
-func (l *tomlLexer) lexDate() tomlLexStateFn {
-	l.emit(tokenDate)
-	return l.lexRvalue
+// returns a state emitting the date or time of the given type, which has been
+// read already
+func (l *tomlLexer) lexDate(typ tokenType) tomlLexStateFn {
+	return func() tomlLexStateFn {
+		if !isValueTerminator(l.peek()) {
+			return l.errorf("invalid date-time %s", l.unterminatedValue())
+		}
+		l.emit(typ)
+		return l.lexRvalue
+	}
+}
+
+// returns the longest date or time at the start of s, and its token type
+func matchDateTime(s string) (tokenType, string) {
+	if match := dateRegexp.FindString(s); match != "" {
+		return tokenDate, match
+	}
+	if match := localDateTimeRegexp.FindString(s); match != "" {
+		return tokenLocalDateTime, match
+	}
+	if match := localDateRegexp.FindString(s); match != "" {
+		return tokenLocalDate, match
+	}
+	return tokenLocalTime, localTimeRegexp.FindString(s)
 }
 
 func (l *tomlLexer) lexTrue() tomlLexStateFn {
-	l.fastForward(4)
-	l.emit(tokenTrue)
-	return l.lexRvalue
+	return l.lexBool(tokenTrue, 4)
 }
 
 func (l *tomlLexer) lexFalse() tomlLexStateFn {
-	l.fastForward(5)
-	l.emit(tokenFalse)
+	return l.lexBool(tokenFalse, 5)
+}
+
+// lexes a boolean of the given length, which must not be directly followed by
+// another value, such as in truex
+func (l *tomlLexer) lexBool(typ tokenType, size int) tomlLexStateFn {
+	l.fastForward(size)
+	if !isValueTerminator(l.peek()) {
+		return l.errorf("invalid boolean %s", l.unterminatedValue())
+	}
+	l.emit(typ)
 	return l.lexRvalue
 }
 
+// consumes the rest of a value which is not properly terminated, and returns
+// it as a whole to report it in an error
+func (l *tomlLexer) unterminatedValue() string {
+	for !isValueTerminator(l.peek()) {
+		l.next()
+	}
+	return string(l.input[l.currentTokenStart:l.currentTokenStop])
+}
+
+// reports whether r may directly follow a scalar value, or a key of an inline
+// table lexed as one
+func isValueTerminator(r rune) bool {
+	switch r {
+	case eof, '\n', '\r', '#', ',', ']', '}', '=':
+		return true
+	}
+	return isSpace(r)
+}
+
 func (l *tomlLexer) lexInf() tomlLexStateFn {
-	l.fastForward(3)
-	l.emit(tokenInf)
-	return l.lexRvalue
+	return l.lexSpecialFloat(tokenInf)
 }
 
 func (l *tomlLexer) lexNan() tomlLexStateFn {
+	return l.lexSpecialFloat(tokenNan)
+}
+
+// lexes inf or nan, after their optional sign
+func (l *tomlLexer) lexSpecialFloat(typ tokenType) tomlLexStateFn {
 	l.fastForward(3)
-	l.emit(tokenNan)
+	if !isValueTerminator(l.peek()) {
+		return l.errorf("invalid float %s", l.unterminatedValue())
+	}
+	l.emit(typ)
 	return l.lexRvalue
 }
 
+// reports whether the input starts with the boolean b in any case; other cases
+// than lowercase are keys of inline tables if a value is not expected
+func (l *tomlLexer) followBoolean(b string) bool {
+	if l.follow(b) {
+		return true
+	}
+	return l.expectsValue() && strings.EqualFold(l.peekString(len(b)), b)
+}
+
+// reports whether a value is expected next, after an equal sign or within an
+// array, rather than the key of an inline table
+func (l *tomlLexer) expectsValue() bool {
+	if len(l.tokens) > 0 && l.tokens[len(l.tokens)-1].typ == tokenEqual {
+		return true
+	}
+	return len(l.brackets) > 0 && l.brackets[len(l.brackets)-1] == '['
+}
+
+// reports whether the input continues with inf or nan in a case other than
+// lowercase, which TOML does not allow
+func (l *tomlLexer) followMiscasedSpecialFloat() bool {
+	end := l.inputIdx + 3
+	if end > len(l.input) || l.follow("inf") || l.follow("nan") {
+		return false
+	}
+	word := string(l.input[l.inputIdx:end])
+	if !strings.EqualFold(word, "inf") && !strings.EqualFold(word, "nan") {
+		return false
+	}
+	return end == len(l.input) || isValueTerminator(l.input[end])
+}
+
 func (l *tomlLexer) lexEqual() tomlLexStateFn {
 	l.next()
 	l.emit(tokenEqual)
@@ -337,19 +534,44 @@ func (l *tomlLexer) lexKey() tomlLexStateFn {
 	return l.lexVoid
 }
 
+// a comment skipped by the lexer, kept aside for the parser
+type lexedComment struct {
+	Position
+	text     string // without the leading # and surrounding whitespace
+	trailing bool   // whether the comment follows other tokens on its line
+}
+
 func (l *tomlLexer) lexComment(previousState tomlLexStateFn) tomlLexStateFn {
 	return func() tomlLexStateFn {
+		start := l.inputIdx
+		pos := Position{l.endbufferLine, l.endbufferCol}
 		for next := l.peek(); next != '\n' && next != eof; next = l.peek() {
 			if next == '\r' && l.follow("\r\n") {
 				break
 			}
 			l.next()
 		}
+		l.comments = append(l.comments, lexedComment{
+			Position: pos,
+			text:     strings.TrimSpace(string(l.input[start+1 : l.inputIdx])),
+			trailing: !l.lineIsBlankBefore(start),
+		})
 		l.ignore()
 		return previousState
 	}
 }
 
+// whether the input only has whitespace between the start of the line and
+// the rune at idx
+func (l *tomlLexer) lineIsBlankBefore(idx int) bool {
+	for i := idx - 1; i >= 0 && l.input[i] != '\n'; i-- {
+		if !isSpace(l.input[i]) && l.input[i] != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
 func (l *tomlLexer) lexLeftBracket() tomlLexStateFn {
 	l.next()
 	l.emit(tokenLeftBracket)
@@ -371,6 +593,12 @@ func (l *tomlLexer) lexLiteralStringAsString(terminator string, discardLeadingNe
 	// find end of string
 	for {
 		if l.follow(terminator) {
+			// one or two apostrophes can precede the closing delimiter of a
+			// multiline string
+			for i := 0; i < 2 && len(terminator) > 1 && l.follow(terminator+"'"); i++ {
+				growingString += "'"
+				l.next()
+			}
 			return growingString, nil
 		}
 
@@ -381,10 +609,12 @@ func (l *tomlLexer) lexLiteralStringAsString(terminator string, discardLeadingNe
 		growingString += string(l.next())
 	}
 
-	return "", errors.New("unclosed string")
+	return "", errUnclosedString
 }
 
 func (l *tomlLexer) lexLiteralString() tomlLexStateFn {
+	start := l.currentTokenStartByte
+	opening := Position{l.line, l.col}
 	l.skip()
 
 	// handle special case for triple-quote
@@ -399,11 +629,15 @@ func (l *tomlLexer) lexLiteralString() tomlLexStateFn {
 
 	str, err := l.lexLiteralStringAsString(terminator, discardLeadingNewLine)
 	if err != nil {
+		if len(terminator) > 1 {
+			return l.unclosedMultilineString(opening, err)
+		}
 		return l.errorf(err.Error())
 	}
 
 	l.emitWithValue(tokenString, str)
 	l.fastForward(len(terminator))
+	l.extendLastTokenSpan(start)
 	l.ignore()
 	return l.lexRvalue
 }
@@ -425,6 +659,12 @@ func (l *tomlLexer) lexStringAsString(terminator string, discardLeadingNewLine,
 
 	for {
 		if l.follow(terminator) {
+			// one or two quotes can precede the closing delimiter of a
+			// multiline string
+			for i := 0; i < 2 && len(terminator) > 1 && l.follow(terminator+`"`); i++ {
+				growingString += `"`
+				l.next()
+			}
 			return growingString, nil
 		}
 
@@ -438,7 +678,17 @@ func (l *tomlLexer) lexStringAsString(terminator string, discardLeadingNewLine,
 			case '\t':
 				fallthrough
 			case ' ':
-				// skip all whitespace chars following backslash
+				if !acceptNewLines {
+					return "", errors.New("invalid escape sequence: \\" + string(l.peek()))
+				}
+				// a backslash ending a line trims the whitespace and newlines
+				// following it
+				for l.peek() == ' ' || l.peek() == '\t' {
+					l.next()
+				}
+				if l.peek() != '\n' && !l.follow("\r\n") {
+					return "", errors.New("only whitespace can follow a line ending backslash")
+				}
 				for strings.ContainsRune("\r\n\t ", l.peek()) {
 					l.next()
 				}
@@ -516,10 +766,12 @@ func (l *tomlLexer) lexStringAsString(terminator string, discardLeadingNewLine,
 		}
 	}
 
-	return "", errors.New("unclosed string")
+	return "", errUnclosedString
 }
 
 func (l *tomlLexer) lexString() tomlLexStateFn {
+	start := l.currentTokenStartByte
+	opening := Position{l.line, l.col}
 	l.skip()
 
 	// handle special case for triple-quote
@@ -537,15 +789,28 @@ func (l *tomlLexer) lexString() tomlLexStateFn {
 	str, err := l.lexStringAsString(terminator, discardLeadingNewLine, acceptNewLines)
 
 	if err != nil {
+		if len(terminator) > 1 {
+			return l.unclosedMultilineString(opening, err)
+		}
 		return l.errorf(err.Error())
 	}
 
 	l.emitWithValue(tokenString, str)
 	l.fastForward(len(terminator))
+	l.extendLastTokenSpan(start)
 	l.ignore()
 	return l.lexRvalue
 }
 
+// report an error inside a multiline string; an unterminated string is
+// reported at the opening delimiter, where it began
+func (l *tomlLexer) unclosedMultilineString(opening Position, err error) tomlLexStateFn {
+	if err != errUnclosedString {
+		return l.errorf(err.Error())
+	}
+	return l.errorfAt(opening, "unclosed multiline string starting at %s", opening)
+}
+
 func (l *tomlLexer) lexTableKey() tomlLexStateFn {
 	l.next()
 
@@ -574,6 +839,7 @@ func (l *tomlLexer) lexInsideTableArrayKey() tomlLexStateFn {
 			}
 			l.next()
 			l.emit(tokenDoubleRightBracket)
+			l.headerEnded = true
 			return l.lexVoid
 		case '[':
 			return l.errorf("table array key cannot contain ']'")
@@ -594,6 +860,7 @@ func (l *tomlLexer) lexInsideTableKey() tomlLexStateFn {
 			}
 			l.next()
 			l.emit(tokenRightBracket)
+			l.headerEnded = true
 			return l.lexVoid
 		case '[':
 			return l.errorf("table key cannot contain ']'")
@@ -663,6 +930,9 @@ func (l *tomlLexer) lexNumber() tomlLexStateFn {
 				if !digitSeen {
 					return l.errorf("number needs at least one digit")
 				}
+				if !isValueTerminator(l.peek()) {
+					return l.errorf("invalid number %s", l.unterminatedValue())
+				}
 
 				l.emit(tokenInteger)
 
@@ -679,6 +949,12 @@ func (l *tomlLexer) lexNumber() tomlLexStateFn {
 		if l.follow("nan") {
 			return l.lexNan
 		}
+		if l.followMiscasedSpecialFloat() {
+			return l.errorf("inf and nan must be lowercase, got %s", l.peekString(3))
+		}
+		if l.follow("0x") || l.follow("0o") || l.follow("0b") {
+			return l.errorf("hexadecimal, octal and binary integers cannot have a sign")
+		}
 	}
 
 	pointSeen := false
@@ -691,6 +967,9 @@ func (l *tomlLexer) lexNumber() tomlLexStateFn {
 				return l.errorf("cannot have two dots in one float")
 			}
 			l.next()
+			if l.peek() == '_' {
+				return l.errorf("invalid use of _ in number")
+			}
 			if !isDigit(l.peek()) {
 				return l.errorf("float cannot end with a dot")
 			}
@@ -702,6 +981,9 @@ func (l *tomlLexer) lexNumber() tomlLexStateFn {
 			if r == '+' || r == '-' {
 				l.next()
 			}
+			if r := l.peek(); !isDigit(r) && r != '_' {
+				return l.errorf("float exponent needs at least one digit")
+			}
 		} else if isDigit(next) {
 			digitSeen = true
 			l.next()
@@ -718,6 +1000,9 @@ func (l *tomlLexer) lexNumber() tomlLexStateFn {
 	if !digitSeen {
 		return l.errorf("no digit in that number")
 	}
+	if !isValueTerminator(l.peek()) {
+		return l.errorf("invalid number %s", l.unterminatedValue())
+	}
 	if pointSeen || expSeen {
 		l.emit(tokenFloat)
 	} else {
@@ -733,20 +1018,62 @@ func (l *tomlLexer) run() {
 }
 
 func init() {
-	dateRegexp = regexp.MustCompile(`^\d{1,4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d{1,9})?(Z|[+-]\d{2}:\d{2})`)
+	dateRegexp = regexp.MustCompile(`^\d{1,4}-\d{2}-\d{2}[Tt ]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})`)
+	localDateTimeRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[Tt ]\d{2}:\d{2}:\d{2}(\.\d+)?`)
+	localDateRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+	localTimeRegexp = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?`)
 }
 
 // Entry point
 func lexToml(inputBytes []byte) []token {
+	tokens, _, _ := lexTomlWithSpans(inputBytes, false)
+	return tokens
+}
+
+// lexTomlWithSpans lexes the input like lexToml, and also returns the byte
+// span of each token within the input and the comments that were skipped.
+// Tabs indenting lines are reported as errors if disallowTabs is set.
+func lexTomlWithSpans(inputBytes []byte, disallowTabs bool) ([]token, []Span, []lexedComment) {
+	if tok, span, ok := validateUTF8(inputBytes); !ok {
+		return []token{tok}, []Span{span}, nil
+	}
 	runes := bytes.Runes(inputBytes)
 	l := &tomlLexer{
 		input:         runes,
 		tokens:        make([]token, 0, 256),
+		spans:         make([]Span, 0, 256),
 		line:          1,
 		col:           1,
 		endbufferLine: 1,
 		endbufferCol:  1,
+		disallowTabs:  disallowTabs,
 	}
 	l.run()
-	return l.tokens
+	return l.tokens, l.spans, l.comments
+}
+
+// validateUTF8 checks that the input is valid UTF-8, as TOML documents must
+// be, before it is converted to runes: invalid sequences would otherwise be
+// silently replaced by U+FFFD. If not, it returns an error token positioned
+// at the first invalid byte.
+func validateUTF8(input []byte) (token, Span, bool) {
+	line, col := 1, 1
+	for i := 0; i < len(input); {
+		r, size := utf8.DecodeRune(input[i:])
+		if r == utf8.RuneError && size == 1 {
+			return token{
+				Position: Position{line, col},
+				typ:      tokenError,
+				val:      fmt.Sprintf("invalid UTF-8 byte 0x%02x", input[i]),
+			}, Span{Start: i, End: i + 1}, false
+		}
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+		i += size
+	}
+	return token{}, Span{}, true
 }
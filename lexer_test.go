@@ -299,6 +299,42 @@ func TestDateRegexp(t *testing.T) {
 	if dateRegexp.FindString("1979-05-27T00:32:00.999999-07:00") == "" {
 		t.Error("nano precision lexing")
 	}
+	if dateRegexp.FindString("1979-05-27 07:32:00Z") == "" {
+		t.Error("space separator lexing")
+	}
+	if dateRegexp.FindString("1979-05-27T07:32:00.1234567891234Z") == "" {
+		t.Error("arbitrary precision lexing")
+	}
+	if dateRegexp.FindString("1979-05-27t07:32:00z") == "" {
+		t.Error("lowercase lexing")
+	}
+	if dateRegexp.FindString("1979-05-27X07:32:00Z") != "" {
+		t.Error("invalid separator lexing")
+	}
+}
+
+func TestLexDateWithSpace(t *testing.T) {
+	testFlow(t, "foo = 1979-05-27 07:32:00Z # comment", []token{
+		{Position{1, 1}, tokenKey, "foo"},
+		{Position{1, 5}, tokenEqual, "="},
+		{Position{1, 7}, tokenDate, "1979-05-27 07:32:00Z"},
+		{Position{1, 37}, tokenEOF, ""},
+	})
+}
+
+func TestLexLocalDates(t *testing.T) {
+	testFlow(t, "a = 1979-05-27T07:32:00.5\nb = 1979-05-27\nc = 07:32:00", []token{
+		{Position{1, 1}, tokenKey, "a"},
+		{Position{1, 3}, tokenEqual, "="},
+		{Position{1, 5}, tokenLocalDateTime, "1979-05-27T07:32:00.5"},
+		{Position{2, 1}, tokenKey, "b"},
+		{Position{2, 3}, tokenEqual, "="},
+		{Position{2, 5}, tokenLocalDate, "1979-05-27"},
+		{Position{3, 1}, tokenKey, "c"},
+		{Position{3, 3}, tokenEqual, "="},
+		{Position{3, 5}, tokenLocalTime, "07:32:00"},
+		{Position{3, 13}, tokenEOF, ""},
+	})
 }
 
 func TestKeyEqualDate(t *testing.T) {
@@ -609,6 +645,40 @@ func TestMultilineLiteralString(t *testing.T) {
 		{Position{2, 1}, tokenString, "hello\r\n'literal'\r\nworld"},
 		{Position{4, 9}, tokenEOF, ""},
 	})
+
+	testFlow(t, "path = '''\nC:\\Users\\new\\t\\u0041\\'''", []token{
+		{Position{1, 1}, tokenKey, "path"},
+		{Position{1, 6}, tokenEqual, "="},
+		{Position{2, 1}, tokenString, `C:\Users\new\t\u0041\`},
+		{Position{2, 25}, tokenEOF, ""},
+	})
+
+	testFlow(t, "foo = ''''quoted''''", []token{
+		{Position{1, 1}, tokenKey, "foo"},
+		{Position{1, 5}, tokenEqual, "="},
+		{Position{1, 10}, tokenString, "'quoted'"},
+		{Position{1, 21}, tokenEOF, ""},
+	})
+
+	testFlow(t, "foo = '''it''''' # two apostrophes", []token{
+		{Position{1, 1}, tokenKey, "foo"},
+		{Position{1, 5}, tokenEqual, "="},
+		{Position{1, 10}, tokenString, "it''"},
+		{Position{1, 35}, tokenEOF, ""},
+	})
+}
+
+func TestUnclosedMultilineString(t *testing.T) {
+	testFlow(t, "foo = \"\"\"\nbar", []token{
+		{Position{1, 1}, tokenKey, "foo"},
+		{Position{1, 5}, tokenEqual, "="},
+		{Position{1, 7}, tokenError, "unclosed multiline string starting at (1, 7)"},
+	})
+	testFlow(t, "foo = \"\"\"bar\\q\"\"\"", []token{
+		{Position{1, 1}, tokenKey, "foo"},
+		{Position{1, 5}, tokenEqual, "="},
+		{Position{1, 10}, tokenError, "invalid escape sequence: \\q"},
+	})
 }
 
 func TestMultilineString(t *testing.T) {
@@ -662,6 +732,31 @@ func TestMultilineString(t *testing.T) {
 	})
 }
 
+func TestMultilineStringLineContinuation(t *testing.T) {
+	testFlow(t, "foo = \"\"\"\nThe quick \\  \t\r\n\n    brown \\\n  fox\"\"\"", []token{
+		{Position{1, 1}, tokenKey, "foo"},
+		{Position{1, 5}, tokenEqual, "="},
+		{Position{2, 1}, tokenString, "The quick brown fox"},
+		{Position{5, 9}, tokenEOF, ""},
+	})
+}
+
+func TestMultilineStringQuotesBeforeDelimiter(t *testing.T) {
+	testFlow(t, `foo = """say "hi"""""`, []token{
+		{Position{1, 1}, tokenKey, "foo"},
+		{Position{1, 5}, tokenEqual, "="},
+		{Position{1, 10}, tokenString, `say "hi""`},
+		{Position{1, 22}, tokenEOF, ""},
+	})
+
+	testFlow(t, `foo = """"quoted""""`, []token{
+		{Position{1, 1}, tokenKey, "foo"},
+		{Position{1, 5}, tokenEqual, "="},
+		{Position{1, 10}, tokenString, `"quoted"`},
+		{Position{1, 21}, tokenEOF, ""},
+	})
+}
+
 func TestUnicodeString(t *testing.T) {
 	testFlow(t, `foo = "hello ♥ world"`, []token{
 		{Position{1, 1}, tokenKey, "foo"},
@@ -748,3 +843,34 @@ pluralizeListTitles = false
 		lexToml([]byte(sample))
 	}
 }
+
+func TestLexInvalidUTF8(t *testing.T) {
+	testFlow(t, "a = \"b\"\nc = \"\xff\"", []token{
+		{Position{2, 6}, tokenError, "invalid UTF-8 byte 0xff"},
+	})
+	testFlow(t, "a = \"\xe2\x82\"", []token{
+		{Position{1, 6}, tokenError, "invalid UTF-8 byte 0xe2"},
+	})
+	testFlow(t, "a = \"\xef\xbf\xbd\"", []token{
+		{Position{1, 1}, tokenKey, "a"},
+		{Position{1, 3}, tokenEqual, "="},
+		{Position{1, 6}, tokenString, "�"},
+		{Position{1, 8}, tokenEOF, ""},
+	})
+}
+
+func TestLexBoolTerminator(t *testing.T) {
+	testFlow(t, "a = truex", []token{
+		{Position{1, 1}, tokenKey, "a"},
+		{Position{1, 3}, tokenEqual, "="},
+		{Position{1, 5}, tokenError, "invalid boolean truex"},
+	})
+	testFlow(t, "a = [false]", []token{
+		{Position{1, 1}, tokenKey, "a"},
+		{Position{1, 3}, tokenEqual, "="},
+		{Position{1, 5}, tokenLeftBracket, "["},
+		{Position{1, 6}, tokenFalse, "false"},
+		{Position{1, 11}, tokenRightBracket, "]"},
+		{Position{1, 12}, tokenEOF, ""},
+	})
+}
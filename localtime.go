@@ -0,0 +1,125 @@
+package toml
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LocalDate represents a calendar day without a time zone, such as the TOML
+// local date 1979-05-27.
+type LocalDate struct {
+	Year  int        // year, e.g. 1979
+	Month time.Month // month of the year, January = 1
+	Day   int        // day of the month, starting at 1
+}
+
+// LocalDateOf returns the LocalDate of t, in t's location.
+func LocalDateOf(t time.Time) LocalDate {
+	var d LocalDate
+	d.Year, d.Month, d.Day = t.Date()
+	return d
+}
+
+// ParseLocalDate parses a date in the YYYY-MM-DD format.
+func ParseLocalDate(s string) (LocalDate, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return LocalDate{}, err
+	}
+	return LocalDateOf(t), nil
+}
+
+// String returns the date in the YYYY-MM-DD format.
+func (d LocalDate) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// In returns the time at midnight of the date in the given location.
+func (d LocalDate) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// LocalTime represents a time of day without a date nor a time zone, such as
+// the TOML local time 07:32:00.
+type LocalTime struct {
+	Hour       int // hour of the day, from 0 to 23
+	Minute     int // minute of the hour, from 0 to 59
+	Second     int // second of the minute, from 0 to 59
+	Nanosecond int // nanosecond of the second, from 0 to 999999999
+}
+
+// LocalTimeOf returns the LocalTime of t, in t's location.
+func LocalTimeOf(t time.Time) LocalTime {
+	var tm LocalTime
+	tm.Hour, tm.Minute, tm.Second = t.Clock()
+	tm.Nanosecond = t.Nanosecond()
+	return tm
+}
+
+// ParseLocalTime parses a time in the HH:MM:SS format, optionally followed
+// by fractional seconds. Fractional seconds beyond nanoseconds are truncated.
+func ParseLocalTime(s string) (LocalTime, error) {
+	t, err := time.Parse("15:04:05.999999999", s)
+	if err != nil {
+		return LocalTime{}, err
+	}
+	return LocalTimeOf(t), nil
+}
+
+// String returns the time in the HH:MM:SS format, followed by fractional
+// seconds if any.
+func (t LocalTime) String() string {
+	s := fmt.Sprintf("%02d:%02d:%02d", t.Hour, t.Minute, t.Second)
+	if t.Nanosecond == 0 {
+		return s
+	}
+	return s + strings.TrimRight(fmt.Sprintf(".%09d", t.Nanosecond), "0")
+}
+
+// LocalDateTime represents a date and time without a time zone, such as the
+// TOML local date-time 1979-05-27T07:32:00.
+type LocalDateTime struct {
+	Date LocalDate
+	Time LocalTime
+}
+
+// LocalDateTimeOf returns the LocalDateTime of t, in t's location.
+func LocalDateTimeOf(t time.Time) LocalDateTime {
+	return LocalDateTime{Date: LocalDateOf(t), Time: LocalTimeOf(t)}
+}
+
+// ParseLocalDateTime parses a date and a time separated by a T, a t or a space,
+// in the formats of ParseLocalDate and ParseLocalTime.
+func ParseLocalDateTime(s string) (LocalDateTime, error) {
+	t, err := time.Parse("2006-01-02T15:04:05.999999999", normalizeDateTime(s))
+	if err != nil {
+		return LocalDateTime{}, err
+	}
+	return LocalDateTimeOf(t), nil
+}
+
+// String returns the date-time in the YYYY-MM-DDTHH:MM:SS format, followed by
+// fractional seconds if any.
+func (dt LocalDateTime) String() string {
+	return dt.Date.String() + "T" + dt.Time.String()
+}
+
+// In returns the time of the date-time in the given location.
+func (dt LocalDateTime) In(loc *time.Location) time.Time {
+	return time.Date(dt.Date.Year, dt.Date.Month, dt.Date.Day,
+		dt.Time.Hour, dt.Time.Minute, dt.Time.Second, dt.Time.Nanosecond, loc)
+}
+
+// Returns a date-time with its date and time separated by a T, and its Z
+// offset in uppercase, as expected by time.Parse. TOML, as RFC 3339, also
+// allows a space and lowercase letters.
+func normalizeDateTime(s string) string {
+	if i := strings.IndexAny(s, " t"); i >= 0 {
+		s = s[:i] + "T" + s[i+1:]
+	}
+	if strings.HasSuffix(s, "z") {
+		s = s[:len(s)-1] + "Z"
+	}
+	return s
+}
@@ -0,0 +1,48 @@
+package toml
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalDateTimeRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		input, expected string
+		parse           func(string) (interface{}, error)
+	}{
+		{"1979-05-27", "1979-05-27", func(s string) (interface{}, error) { return ParseLocalDate(s) }},
+		{"07:32:00", "07:32:00", func(s string) (interface{}, error) { return ParseLocalTime(s) }},
+		{"00:32:00.999999", "00:32:00.999999", func(s string) (interface{}, error) { return ParseLocalTime(s) }},
+		{"1979-05-27T07:32:00", "1979-05-27T07:32:00", func(s string) (interface{}, error) { return ParseLocalDateTime(s) }},
+		{"1979-05-27 07:32:00.5", "1979-05-27T07:32:00.5", func(s string) (interface{}, error) { return ParseLocalDateTime(s) }},
+	} {
+		value, err := test.parse(test.input)
+		if err != nil {
+			t.Errorf("%s: %s", test.input, err)
+			continue
+		}
+		if got := value.(interface{ String() string }).String(); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.input, test.expected, got)
+		}
+	}
+
+	for _, input := range []string{"1979-13-27", "25:00:00", "1979-05-27T07:32"} {
+		if _, err := ParseLocalDateTime(input); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}
+
+func TestLocalDateTimeIn(t *testing.T) {
+	loc := time.FixedZone("", -8*3600)
+	dt := LocalDateTime{LocalDate{1979, time.May, 27}, LocalTime{7, 32, 0, 500}}
+	if expected := time.Date(1979, 5, 27, 7, 32, 0, 500, loc); !dt.In(loc).Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, dt.In(loc))
+	}
+	if expected := time.Date(1979, 5, 27, 0, 0, 0, 0, loc); !dt.Date.In(loc).Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, dt.Date.In(loc))
+	}
+	if LocalDateTimeOf(dt.In(loc)) != dt {
+		t.Errorf("expected %v, got %v", dt, LocalDateTimeOf(dt.In(loc)))
+	}
+}
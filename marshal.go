@@ -2,9 +2,13 @@ package toml
 
 import (
 	"bytes"
+	"encoding"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
+	"os"
 	"reflect"
 	"sort"
 	"strconv"
@@ -27,12 +31,17 @@ type tomlOpts struct {
 	multiline    bool
 	include      bool
 	omitempty    bool
+	remain       bool
+	embedded     bool
 	defaultValue string
+	defaultFn    string
+	oneof        string
+	validate     string
 }
 
 type encOpts struct {
-	quoteMapKeys            bool
-	arraysOneElementPerLine bool
+	quoteMapKeys bool
+	arrayWrap    int // arrays with more elements are written one element per line, unless 0
 }
 
 var encOptsDefaults = encOpts{
@@ -67,7 +76,16 @@ const (
 )
 
 var timeType = reflect.TypeOf(time.Time{})
+var localDateType = reflect.TypeOf(LocalDate{})
+var localTimeType = reflect.TypeOf(LocalTime{})
+var localDateTimeType = reflect.TypeOf(LocalDateTime{})
+var integerType = reflect.TypeOf(Integer{})
 var marshalerType = reflect.TypeOf(new(Marshaler)).Elem()
+var unmarshalerType = reflect.TypeOf(new(Unmarshaler)).Elem()
+var rawMessageType = reflect.TypeOf(RawMessage{})
+var defaulterType = reflect.TypeOf(new(Defaulter)).Elem()
+var validatableType = reflect.TypeOf(new(Validatable)).Elem()
+var textUnmarshalerType = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
 
 // Check if the given marshal type maps to a Tree primitive
 func isPrimitive(mtype reflect.Type) bool {
@@ -85,12 +103,17 @@ func isPrimitive(mtype reflect.Type) bool {
 	case reflect.String:
 		return true
 	case reflect.Struct:
-		return mtype == timeType || isCustomMarshaler(mtype)
+		return mtype == timeType || mtype == integerType || isLocalTimeType(mtype) || isCustomMarshaler(mtype)
 	default:
 		return false
 	}
 }
 
+// Check if the given marshal type is one of the local date and time types
+func isLocalTimeType(mtype reflect.Type) bool {
+	return mtype == localDateType || mtype == localTimeType || mtype == localDateTimeType
+}
+
 // Check if the given marshal type maps to a Tree slice
 func isTreeSlice(mtype reflect.Type) bool {
 	switch mtype.Kind() {
@@ -113,6 +136,19 @@ func isOtherSlice(mtype reflect.Type) bool {
 	}
 }
 
+// Check if the given marshal type is a slice of interface{}, which may hold
+// values of mixed types
+func isInterfaceSlice(mtype reflect.Type) bool {
+	return mtype.Kind() == reflect.Slice && mtype.Elem().Kind() == reflect.Interface
+}
+
+// Check if the given marshal type is a slice of values decoded from strings
+// with encoding.TextUnmarshaler, such as structs which are not otherwise
+// primitive
+func isTextUnmarshalerSlice(mtype reflect.Type) bool {
+	return mtype.Kind() == reflect.Slice && reflect.PtrTo(indirectType(mtype.Elem())).Implements(textUnmarshalerType)
+}
+
 // Check if the given marshal type maps to a Tree
 func isTree(mtype reflect.Type) bool {
 	switch mtype.Kind() {
@@ -139,6 +175,49 @@ type Marshaler interface {
 	MarshalTOML() ([]byte, error)
 }
 
+// Unmarshaler is the interface implemented by types that can unmarshal
+// themselves from a TOML value. UnmarshalTOML receives the value decoded with
+// the generic types documented on Tree.ToMap, such as a
+// map[string]interface{} for a table.
+type Unmarshaler interface {
+	UnmarshalTOML(interface{}) error
+}
+
+// RawMessage is a raw encoded TOML value. Decoding a value into a RawMessage
+// stores its source text without interpreting it, e.g. `0x10` or
+// `{ name = "a" }`, so that it can be processed later. A table defined by a
+// table header has no single source text, and is stored as a TOML document
+// holding its keys, which can be decoded with Unmarshal.
+//
+// RawMessage is supported for struct fields and map values.
+type RawMessage []byte
+
+// Defaulter is the interface implemented by types that can set their own
+// default values. SetDefaults is called before the type is unmarshaled, so
+// values present in the TOML document override the defaults.
+type Defaulter interface {
+	SetDefaults()
+}
+
+// Validatable is the interface implemented by types that can check their own
+// values once unmarshaled, such as invariants between fields. An error
+// returned by Validate is returned by the decoder.
+type Validatable interface {
+	Validate() error
+}
+
+// Apply defaults to the given addressable struct value, nested structs first
+func callDefaulter(mval reflect.Value) {
+	for i := 0; i < mval.NumField(); i++ {
+		if f := mval.Field(i); f.Kind() == reflect.Struct && f.Type() != timeType && f.CanSet() {
+			callDefaulter(f)
+		}
+	}
+	if mval.Addr().Type().Implements(defaulterType) {
+		mval.Addr().Interface().(Defaulter).SetDefaults()
+	}
+}
+
 /*
 Marshal returns the TOML encoding of v.  Behavior is similar to the Go json
 encoder, except that there is no concept of a Marshaler interface or MarshalTOML
@@ -149,6 +228,8 @@ The following struct annotations are supported:
 
   toml:"Field"      Overrides the field's name to output.
   omitempty         When set, empty values and groups are not emitted.
+  embedded          When set, the struct or map is emitted as a TOML document
+                    stored in a string.
   comment:"comment" Emits a # comment on the same line. This supports new lines.
   commented:"true"  Emits the value as commented.
 
@@ -171,6 +252,7 @@ Tree primitive types and corresponding marshal types:
   string     string, pointers to same
   bool       bool, pointers to same
   time.Time  time.Time{}, pointers to same
+  LocalDate, LocalTime, LocalDateTime  the same types, pointers to same
 
 For additional flexibility, use the Encoder API.
 */
@@ -178,14 +260,93 @@ func Marshal(v interface{}) ([]byte, error) {
 	return NewEncoder(nil).marshal(v)
 }
 
+// Example returns an example TOML document for the struct type of v.
+//
+// Every field is written, along with its comment tag if any. Fields with a
+// default tag are set to their default value, other fields to the zero value
+// of their type. Nested structs are written as tables, and slices of structs
+// as an array of tables with a single element. Pointers and slices to a struct
+// which is already being written, such as a tree of nodes, are left empty.
+// Only the type of v is used.
+func Example(v interface{}) ([]byte, error) {
+	mtype := reflect.TypeOf(v)
+	if mtype == nil || (mtype.Kind() != reflect.Struct &&
+		(mtype.Kind() != reflect.Ptr || mtype.Elem().Kind() != reflect.Struct)) {
+		return []byte{}, errors.New("Only a struct or pointer to struct can be used as an example")
+	}
+	mval, err := exampleValue(mtype, map[reflect.Type]bool{})
+	if err != nil {
+		return []byte{}, err
+	}
+	e := NewEncoder(nil).Order(OrderPreserve)
+	e.example = true
+	return e.marshal(mval.Interface())
+}
+
+// Build a value of the given type suitable for Example. visiting holds the
+// struct types being built, whose recursive pointers and slices are left empty.
+func exampleValue(mtype reflect.Type, visiting map[reflect.Type]bool) (reflect.Value, error) {
+	switch {
+	case (mtype.Kind() == reflect.Ptr || mtype.Kind() == reflect.Slice) && visiting[indirectType(mtype.Elem())]:
+		return reflect.Zero(mtype), nil
+	case mtype.Kind() == reflect.Ptr:
+		elem, err := exampleValue(mtype.Elem(), visiting)
+		if err != nil {
+			return elem, err
+		}
+		mval := reflect.New(mtype.Elem())
+		mval.Elem().Set(elem)
+		return mval, nil
+	case isTreeSlice(mtype):
+		elem, err := exampleValue(mtype.Elem(), visiting)
+		if err != nil {
+			return elem, err
+		}
+		return reflect.Append(reflect.MakeSlice(mtype, 0, 1), elem), nil
+	case mtype.Kind() == reflect.Struct && !isPrimitive(mtype):
+		visiting[mtype] = true
+		defer delete(visiting, mtype)
+		mval := reflect.New(mtype).Elem()
+		for i := 0; i < mtype.NumField(); i++ {
+			mtypef := mtype.Field(i)
+			opts := tomlOptions(mtypef, annotationDefault)
+			if !opts.include {
+				continue
+			}
+			if opts.defaultValue != "" {
+				val, err := parseDefaultValue(mtypef.Type.Kind(), opts.defaultValue)
+				if err != nil {
+					return mval, err
+				}
+				mval.Field(i).Set(reflect.ValueOf(val).Convert(mtypef.Type))
+				continue
+			}
+			mvalf, err := exampleValue(mtypef.Type, visiting)
+			if err != nil {
+				return mval, err
+			}
+			mval.Field(i).Set(mvalf)
+		}
+		return mval, nil
+	case mtype.Kind() == reflect.Map:
+		return reflect.MakeMap(mtype), nil
+	default:
+		return reflect.Zero(mtype), nil
+	}
+}
+
 // Encoder writes TOML values to an output stream.
 type Encoder struct {
 	w io.Writer
 	encOpts
 	annotation
-	line  int
-	col   int
-	order marshalOrder
+	line    int
+	col     int
+	order   marshalOrder
+	example bool
+
+	sortTablesBy    string
+	omitEmptyTables bool
 }
 
 // NewEncoder returns a new encoder that writes to w.
@@ -214,6 +375,49 @@ func (e *Encoder) Encode(v interface{}) error {
 	return nil
 }
 
+// StreamArrayOfTables writes an array of tables called name one table at a
+// time, so that the whole array does not have to be held in memory. Each call
+// of the returned write function encodes elem, a struct or a map, as a
+// [[name]] table. A dotted name, such as "a.b", nests the array in tables,
+// which are created implicitly by the headers. The returned close function
+// must be called once all the tables are written, after which write fails.
+//
+// Other values must not be written by the encoder while the array is being
+// streamed, as they would become part of its last table.
+func (e *Encoder) StreamArrayOfTables(name string) (func(elem interface{}) error, func() error) {
+	keys, keyErr := parseKey(name)
+	closed := false
+	write := func(elem interface{}) error {
+		if keyErr != nil {
+			return fmt.Errorf("invalid array of tables name %s: %s", name, keyErr)
+		}
+		if closed {
+			return fmt.Errorf("array of tables %s is closed", name)
+		}
+		mtype := reflect.TypeOf(elem)
+		if mtype == nil || !isTree(mtype) && (mtype.Kind() != reflect.Ptr || !isTree(mtype.Elem())) {
+			return fmt.Errorf("array of tables %s can only hold structs or maps, got %T", name, elem)
+		}
+		t, err := e.valueToTree(mtype, reflect.ValueOf(elem))
+		if err != nil {
+			return err
+		}
+		// only the headers of the array are written, not the ones of the
+		// tables holding it, which would be defined again by each call
+		last := len(keys) - 1
+		root := newTree()
+		root.values[quoteKeyIfNeeded(keys[last])] = []*Tree{t}
+		indent := strings.Repeat("  ", last)
+		_, err = root.writeToOrdered(e.w, indent, CanonicalKey(keys[:last]), 0, e.arrayWrap, e.order)
+		return err
+	}
+	closeFn := func() error {
+		closed = true
+		return nil
+	}
+	return write, closeFn
+}
+
 // QuoteMapKeys sets up the encoder to encode
 // maps with string type keys with quoted TOML keys.
 //
@@ -238,7 +442,18 @@ func (e *Encoder) QuoteMapKeys(v bool) *Encoder {
 //     3,
 //   ]
 func (e *Encoder) ArraysWithOneElementPerLine(v bool) *Encoder {
-	e.arraysOneElementPerLine = v
+	if v {
+		return e.SetArrayWrap(1)
+	}
+	return e.SetArrayWrap(0)
+}
+
+// SetArrayWrap sets up the encoder to encode arrays with more than maxInline
+// elements on multiple lines, one element per line, as done by
+// ArraysWithOneElementPerLine, and shorter arrays on a single line. Arrays are
+// always encoded on a single line if maxInline is 0, which is the default.
+func (e *Encoder) SetArrayWrap(maxInline int) *Encoder {
+	e.arrayWrap = maxInline
 	return e
 }
 
@@ -248,6 +463,23 @@ func (e *Encoder) Order(ord marshalOrder) *Encoder {
 	return e
 }
 
+// OmitEmptyTables sets up the encoder to omit tables without any value,
+// instead of writing an empty [table] header. By default, empty tables are
+// only omitted for fields tagged omitempty.
+func (e *Encoder) OmitEmptyTables(v bool) *Encoder {
+	e.omitEmptyTables = v
+	return e
+}
+
+// SortTablesBy sets up the encoder to write the tables of each array of
+// tables ordered by the value of the given key, for example to write [[users]]
+// ordered by name. Tables missing the key are written last. The encoded value
+// is left unchanged.
+func (e *Encoder) SortTablesBy(key string) *Encoder {
+	e.sortTablesBy = key
+	return e
+}
+
 // SetTagName allows changing default tag "toml"
 func (e *Encoder) SetTagName(v string) *Encoder {
 	e.tag = v
@@ -295,7 +527,7 @@ func (e *Encoder) marshal(v interface{}) ([]byte, error) {
 	}
 
 	var buf bytes.Buffer
-	_, err = t.writeToOrdered(&buf, "", "", 0, e.arraysOneElementPerLine, e.order)
+	_, err = t.writeToOrdered(&buf, "", "", 0, e.arrayWrap, e.order)
 
 	return buf.Bytes(), err
 }
@@ -316,11 +548,22 @@ func (e *Encoder) valueToTree(mtype reflect.Type, mval reflect.Value) (*Tree, er
 		for i := 0; i < mtype.NumField(); i++ {
 			mtypef, mvalf := mtype.Field(i), mval.Field(i)
 			opts := tomlOptions(mtypef, e.annotation)
-			if opts.include && (!opts.omitempty || !isZero(mvalf)) {
-				val, err := e.valueToToml(mtypef.Type, mvalf)
+			// examples write empty fields, except nil pointers left by recursive types
+			example := e.example && !(mvalf.Kind() == reflect.Ptr && mvalf.IsNil())
+			if opts.include && (example || !opts.omitempty || !isZero(mvalf)) {
+				var val interface{}
+				var err error
+				if opts.embedded {
+					val, err = e.valueToEmbedded(mtypef.Type, mvalf)
+				} else {
+					val, err = e.valueToToml(mtypef.Type, mvalf)
+				}
 				if err != nil {
 					return nil, err
 				}
+				if (opts.omitempty || e.omitEmptyTables) && isEmptyTable(val) {
+					continue
+				}
 
 				tval.SetWithOptions(opts.name, SetOptions{
 					Comment:   opts.comment,
@@ -355,8 +598,11 @@ func (e *Encoder) valueToTree(mtype reflect.Type, mval reflect.Value) (*Tree, er
 			if err != nil {
 				return nil, err
 			}
+			if e.omitEmptyTables && isEmptyTable(val) {
+				continue
+			}
 			if e.quoteMapKeys {
-				keyStr, err := tomlValueStringRepresentation(key.String(), "", e.arraysOneElementPerLine)
+				keyStr, err := tomlValueStringRepresentation(key.String(), "", e.arrayWrap)
 				if err != nil {
 					return nil, err
 				}
@@ -369,6 +615,12 @@ func (e *Encoder) valueToTree(mtype reflect.Type, mval reflect.Value) (*Tree, er
 	return tval, nil
 }
 
+// Check if the given toml value is a table without any value
+func isEmptyTable(val interface{}) bool {
+	tree, ok := val.(*Tree)
+	return ok && len(tree.values) == 0
+}
+
 // Convert given marshal slice to slice of Toml trees
 func (e *Encoder) valueToTreeSlice(mtype reflect.Type, mval reflect.Value) ([]*Tree, error) {
 	tval := make([]*Tree, mval.Len(), mval.Len())
@@ -379,9 +631,56 @@ func (e *Encoder) valueToTreeSlice(mtype reflect.Type, mval reflect.Value) ([]*T
 		}
 		tval[i] = val
 	}
+	if e.sortTablesBy != "" {
+		sort.SliceStable(tval, func(i, j int) bool {
+			return lessTomlValues(tval[i].Get(e.sortTablesBy), tval[j].Get(e.sortTablesBy))
+		})
+	}
 	return tval, nil
 }
 
+// Orders scalar toml values of the same type; nil values are ordered last
+func lessTomlValues(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return b == nil && a != nil
+	}
+	switch av := a.(type) {
+	case int64:
+		bv, ok := b.(int64)
+		return ok && av < bv
+	case uint64:
+		bv, ok := b.(uint64)
+		return ok && av < bv
+	case float64:
+		bv, ok := b.(float64)
+		return ok && av < bv
+	case string:
+		bv, ok := b.(string)
+		return ok && av < bv
+	case bool:
+		bv, ok := b.(bool)
+		return ok && !av && bv
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Before(bv)
+	default:
+		return false
+	}
+}
+
+// Encode a struct or map as a TOML document stored in a string, for fields
+// tagged with the embedded option
+func (e *Encoder) valueToEmbedded(mtype reflect.Type, mval reflect.Value) (interface{}, error) {
+	if !isTree(indirectType(mtype)) {
+		return nil, fmt.Errorf("Can't encode %v as embedded TOML, expected a struct or a map", mtype)
+	}
+	tree, err := e.valueToTree(mtype, mval)
+	if err != nil {
+		return nil, err
+	}
+	return tree.ToTomlString()
+}
+
 // Convert given marshal slice to slice of toml values
 func (e *Encoder) valueToOtherSlice(mtype reflect.Type, mval reflect.Value) (interface{}, error) {
 	tval := make([]interface{}, mval.Len(), mval.Len())
@@ -426,6 +725,9 @@ func (e *Encoder) valueToToml(mtype reflect.Type, mval reflect.Value) (interface
 		case reflect.String:
 			return mval.String(), nil
 		case reflect.Struct:
+			if mtype == integerType || isLocalTimeType(mtype) {
+				return mval.Interface(), nil
+			}
 			return mval.Interface().(time.Time), nil
 		default:
 			return nil, fmt.Errorf("Marshal can't handle %v(%v)", mtype, mtype.Kind())
@@ -434,8 +736,7 @@ func (e *Encoder) valueToToml(mtype reflect.Type, mval reflect.Value) (interface
 }
 
 // Unmarshal attempts to unmarshal the Tree into a Go struct pointed by v.
-// Neither Unmarshaler interfaces nor UnmarshalTOML functions are supported for
-// sub-structs, and only definite types can be unmarshaled.
+// Only definite types can be unmarshaled.
 func (t *Tree) Unmarshal(v interface{}) error {
 	d := Decoder{tval: t, tagName: tagFieldName}
 	return d.unmarshal(v)
@@ -450,14 +751,48 @@ func (t *Tree) Marshal() ([]byte, error) {
 }
 
 // Unmarshal parses the TOML-encoded data and stores the result in the value
-// pointed to by v. Behavior is similar to the Go json encoder, except that there
-// is no concept of an Unmarshaler interface or UnmarshalTOML function for
-// sub-structs, and currently only definite types can be unmarshaled to (i.e. no
-// `interface{}`).
+// pointed to by v. Behavior is similar to the Go json encoder. v may point to a
+// struct or a map.
+//
+// Keys are matched to the name of struct fields regardless of their case.
+//
+// Values decoded into an `interface{}` (including the values of a
+// map[string]interface{}) use the generic types documented on Tree.ToMap.
+//
+// String values are decoded with UnmarshalText into types implementing
+// encoding.TextUnmarshaler, including the elements of slices.
+// Likewise, the keys of maps are decoded into key types implementing
+// encoding.TextUnmarshaler, and parsed into integer key types.
+//
+// Types implementing Unmarshaler, including v itself, have UnmarshalTOML
+// called with their value instead of being decoded field by field.
+//
+// Struct fields and map values of type RawMessage keep the source text of
+// their value, to be decoded later.
+//
+// Structs implementing Defaulter have SetDefaults called before their fields
+// are decoded, including nested structs missing from the document.
+//
+// Structs implementing Validatable have Validate called once their fields are
+// decoded, nested structs first, and decoding stops at the first error.
+// Nested structs missing from the document are not validated.
 //
 // The following struct annotations are supported:
 //
 //   toml:"Field" Overrides the field's name to map to.
+//   toml:",remain" Collects the keys not mapped to other fields into this
+//                  field, which must be a map with string keys.
+//   toml:",embedded" Decodes the string value of the key as a TOML document
+//                    into this field, which must be a struct or a map.
+//   toml:",oneof=Group" Requires exactly one of the fields tagged with the
+//                       same group to be defined in the table decoded into
+//                       the struct.
+//   toml:",defaultFn=Name" Provides the default value returned by the
+//                          function registered under Name with
+//                          Decoder.RegisterDefaultFunc.
+//   toml:",validate=Name" Checks the decoded value with the function
+//                         registered under Name with
+//                         Decoder.RegisterValidator.
 //   default:"foo" Provides a default value.
 //
 // For default values, only fields of the following types are supported:
@@ -469,11 +804,33 @@ func (t *Tree) Marshal() ([]byte, error) {
 //
 // See Marshal() documentation for types mapping table.
 func Unmarshal(data []byte, v interface{}) error {
-	t, err := LoadReader(bytes.NewReader(data))
+	return NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// DecodeFlat parses the TOML-encoded data and returns a single-level map whose
+// keys are the full dotted paths of the values (e.g. "server.host"). All
+// tables are flattened; arrays of tables are returned as []interface{} of
+// flat maps relative to each table.
+func DecodeFlat(data []byte) (map[string]interface{}, error) {
+	t, err := LoadBytes(data)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return t.Unmarshal(v)
+	return t.toFlatMap(), nil
+}
+
+// DecodeDelta parses the TOML-encoded data and returns only the keys whose
+// values differ from baseline, or which baseline does not define. Tables are
+// compared key by key, so a changed table only contains its changed keys.
+// Keys of baseline which are absent from data are not reported.
+//
+// baseline is expected to use the types documented on Tree.ToMap.
+func DecodeDelta(data []byte, baseline map[string]interface{}) (map[string]interface{}, error) {
+	t, err := LoadBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return diffMaps(baseline, t.ToMap()), nil
 }
 
 // Decoder reads and decodes TOML values from an input stream.
@@ -481,7 +838,35 @@ type Decoder struct {
 	r    io.Reader
 	tval *Tree
 	encOpts
-	tagName string
+	tagName          string
+	useInt           bool
+	expandEnv        bool
+	strictEnv        bool
+	lenient          bool
+	emptyStringAsNil bool
+	disallowUnknown  bool
+	arrayRootKey     string
+
+	timeLayouts   []string
+	fieldResolver FieldResolver
+	parserOptions parserOptions
+	source        []byte // document decoded into RawMessage values, if known
+
+	recordSpans bool
+	spans       map[string]Span
+	comments    map[string]*keyComments
+
+	onLossyConversion func(path, from, to string)
+	path              []pathSegment // path of the value being decoded
+	defaultFuncs      map[string]func() interface{}
+	validators        map[string]func(interface{}) error
+	enums             map[reflect.Type]map[string]interface{}
+}
+
+// a key, or an index if key is empty, of the path of a decoded value
+type pathSegment struct {
+	key   string
+	index int
 }
 
 // NewDecoder returns a new decoder that reads from r.
@@ -499,23 +884,406 @@ func NewDecoder(r io.Reader) *Decoder {
 // See the documentation for Marshal for details.
 func (d *Decoder) Decode(v interface{}) error {
 	var err error
-	d.tval, err = LoadReader(d.r)
+	inputBytes, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+	d.tval, err = loadBytes(inputBytes, d.parserOptions)
 	if err != nil {
 		return err
 	}
+	d.source = stripBOM(inputBytes)
+	if d.recordSpans {
+		d.spans = map[string]Span{}
+		d.tval.collectSpans(d.spans, "")
+	}
+	if d.parserOptions.keepComments {
+		d.comments = map[string]*keyComments{}
+		d.tval.collectComments(d.comments, "")
+	}
 	return d.unmarshal(v)
 }
 
+// DecodeImmutableInterned reads a TOML-encoded document from the decoder's
+// input and returns it as an ImmutableTree, which is safe for concurrent reads
+// and stores each distinct key string once. The parser options of the decoder
+// apply; the other options only affect Decode.
+func (d *Decoder) DecodeImmutableInterned() (*ImmutableTree, error) {
+	inputBytes, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := loadBytes(inputBytes, d.parserOptions)
+	if err != nil {
+		return nil, err
+	}
+	tree.internKeys(map[string]string{})
+	return &ImmutableTree{tree: tree}, nil
+}
+
+// RecordSpans sets up the decoder to record the byte span of each value
+// within the source document. The spans are available through Spans once
+// Decode has been called.
+//
+// Offsets are relative to the start of the document, after any byte order
+// mark.
+func (d *Decoder) RecordSpans(v bool) *Decoder {
+	d.recordSpans = v
+	return d
+}
+
+// Spans returns the byte spans of the values read by the last call to Decode,
+// keyed by their dotted path (e.g. "server.port"). Key segments which are not
+// valid bare keys are quoted, and tables of arrays of tables are referred to by
+// their index (e.g. "products[0].name").
+//
+// Spans returns nil unless RecordSpans was enabled.
+func (d *Decoder) Spans() map[string]Span {
+	return d.spans
+}
+
+// KeepComments sets up the decoder to keep the comments of the document, which
+// are available through LeadingComments and TrailingComment once Decode has
+// been called. Comments are associated as follows:
+//
+//   - the block of comment lines directly above a key or a table header,
+//     without blank lines in between, are its leading comments.
+//   - the comment following a value or a table header on the same line is
+//     its trailing comment.
+//
+// Comments inside inline tables and arrays are not kept.
+func (d *Decoder) KeepComments(v bool) *Decoder {
+	d.parserOptions.keepComments = v
+	return d
+}
+
+// LeadingComments returns the comment lines directly above the value or table
+// at path, without their # and surrounding whitespace. Paths are formatted as
+// for Spans. It returns nil unless KeepComments was enabled.
+func (d *Decoder) LeadingComments(path string) []string {
+	if c, ok := d.comments[path]; ok {
+		return c.leading
+	}
+	return nil
+}
+
+// TrailingComment returns the comment on the same line after the value or
+// table header at path, without its # and surrounding whitespace. Paths are
+// formatted as for Spans. It returns "" unless KeepComments was enabled.
+func (d *Decoder) TrailingComment(path string) string {
+	if c, ok := d.comments[path]; ok {
+		return c.trailing
+	}
+	return ""
+}
+
+// FieldResolver locates the field of the struct type t in which the value of
+// key should be decoded. It returns false if the key has no matching field.
+type FieldResolver func(t reflect.Type, key string) (reflect.StructField, bool)
+
+// RegisterDefaultFunc registers fn under name, for fields tagged with the
+// defaultFn=name option. When such a field is absent from the document, fn is
+// called and its result is assigned to the field, taking precedence over a
+// default tag. The result must be assignable or convertible to the type of
+// the field.
+func (d *Decoder) RegisterDefaultFunc(name string, fn func() interface{}) *Decoder {
+	if d.defaultFuncs == nil {
+		d.defaultFuncs = map[string]func() interface{}{}
+	}
+	d.defaultFuncs[name] = fn
+	return d
+}
+
+// Compute the default value of a field tagged with the defaultFn option
+func (d *Decoder) callDefaultFunc(mtype reflect.Type, name string) (reflect.Value, error) {
+	fn, ok := d.defaultFuncs[name]
+	if !ok {
+		return reflect.ValueOf(nil), fmt.Errorf("default function %s is not registered", name)
+	}
+	val := reflect.ValueOf(fn())
+	switch {
+	case !val.IsValid():
+		return reflect.Zero(mtype), nil
+	case val.Type().AssignableTo(mtype):
+		return val, nil
+	case val.Type().ConvertibleTo(mtype) && (mtype.Kind() != reflect.String || val.Kind() == reflect.String):
+		// integers are convertible to strings, but not as expected
+		return val.Convert(mtype), nil
+	default:
+		return reflect.ValueOf(nil), fmt.Errorf("default function %s returned %v(%T), which can't be assigned to %v",
+			name, val.Interface(), val.Interface(), mtype.String())
+	}
+}
+
+// RegisterValidator registers fn under name, for fields tagged with the
+// validate=name option. Once the value of such a field is decoded, fn is
+// called with it, and decoding fails with the position of the value if fn
+// returns an error. Validators are not called on default values.
+func (d *Decoder) RegisterValidator(name string, fn func(interface{}) error) *Decoder {
+	if d.validators == nil {
+		d.validators = map[string]func(interface{}) error{}
+	}
+	d.validators[name] = fn
+	return d
+}
+
+// Check the decoded value of a field tagged with the validate option
+func (d *Decoder) callValidator(name string, val reflect.Value) error {
+	fn, ok := d.validators[name]
+	if !ok {
+		return fmt.Errorf("validator %s is not registered", name)
+	}
+	if err := fn(val.Interface()); err != nil {
+		return fmt.Errorf("invalid value for %s: %s", d.currentPath(), err)
+	}
+	return nil
+}
+
+// RegisterEnum registers the values which strings decode into for values of
+// type t, by string. Decoding a string missing from values into a value of
+// type t fails, with an error listing the allowed strings. The values must be
+// assignable or convertible to t.
+func (d *Decoder) RegisterEnum(t reflect.Type, values map[string]interface{}) *Decoder {
+	if d.enums == nil {
+		d.enums = map[reflect.Type]map[string]interface{}{}
+	}
+	d.enums[t] = values
+	return d
+}
+
+// Resolve the value of an enum registered with RegisterEnum
+func enumValue(mtype reflect.Type, values map[string]interface{}, s string) (reflect.Value, error) {
+	value, ok := values[s]
+	if !ok {
+		allowed := make([]string, 0, len(values))
+		for k := range values {
+			allowed = append(allowed, k)
+		}
+		sort.Strings(allowed)
+		return reflect.ValueOf(nil), fmt.Errorf("unknown %v value %q, expected one of: %s",
+			mtype, s, strings.Join(allowed, ", "))
+	}
+	val := reflect.ValueOf(value)
+	switch {
+	case val.IsValid() && val.Type().AssignableTo(mtype):
+		return val, nil
+	case val.IsValid() && val.Type().ConvertibleTo(mtype):
+		return val.Convert(mtype), nil
+	default:
+		return reflect.ValueOf(nil), fmt.Errorf("enum value %v(%T) of %q can't be assigned to %v", value, value, s, mtype)
+	}
+}
+
+// SetFieldResolver replaces the default matching of keys to struct fields,
+// based on the field names and tags, with the given resolver. Default tags are
+// not applied to fields when a resolver is set.
+func (d *Decoder) SetFieldResolver(resolver FieldResolver) *Decoder {
+	d.fieldResolver = resolver
+	return d
+}
+
+// KeepIntegerRadix sets up the decoder to record the radix of integers, so that
+// decoding into Integer fields, or into interface{} values, keeps the radix
+// for encoding them back in the same form. Other integer fields are decoded
+// as usual.
+func (d *Decoder) KeepIntegerRadix(v bool) *Decoder {
+	d.parserOptions.keepIntegerRadix = v
+	return d
+}
+
+// OnLossyConversion sets a function called when a value is decoded into a
+// type which cannot represent it exactly, such as a float into a float32 field
+// or a large integer into a float64 field. It is called with the path of the
+// value, formatted as for Spans, and the names of the source and destination
+// types. The value is decoded regardless.
+func (d *Decoder) OnLossyConversion(fn func(path, from, to string)) *Decoder {
+	d.onLossyConversion = fn
+	return d
+}
+
+// formats the path of the value being decoded, as for Spans
+func (d *Decoder) currentPath() string {
+	var path bytes.Buffer
+	for i, segment := range d.path {
+		if segment.key == "" {
+			fmt.Fprintf(&path, "[%d]", segment.index)
+			continue
+		}
+		if i > 0 {
+			path.WriteByte('.')
+		}
+		path.WriteString(quoteKeyIfNeeded(segment.key))
+	}
+	return path.String()
+}
+
+func (d *Decoder) pushKey(key string) {
+	d.path = append(d.path, pathSegment{key: key})
+}
+
+func (d *Decoder) pushIndex(index int) {
+	d.path = append(d.path, pathSegment{index: index})
+}
+
+func (d *Decoder) popPath() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// OnTable sets a function called for each [table] or [[array of tables]]
+// header, in document order, with the path of the table and the position of
+// the header. It is called while parsing, before any value is decoded.
+func (d *Decoder) OnTable(fn func(path []string, pos Position)) *Decoder {
+	d.parserOptions.onTable = fn
+	return d
+}
+
+// AllowInlineTableTrailingComma sets up the decoder to accept a comma after
+// the last field of an inline table, such as { a = 1, }, which is otherwise a
+// parse error.
+func (d *Decoder) AllowInlineTableTrailingComma(v bool) *Decoder {
+	d.parserOptions.allowInlineTableTrailingComma = v
+	return d
+}
+
+// DisallowUnknownFields causes Decode to return an error when a key of a table
+// decoded into a struct does not match any of its fields, unless the struct
+// has a remain field.
+func (d *Decoder) DisallowUnknownFields() *Decoder {
+	d.disallowUnknown = true
+	return d
+}
+
 // SetTagName allows changing default tag "toml"
 func (d *Decoder) SetTagName(v string) *Decoder {
 	d.tagName = v
 	return d
 }
 
+// UseInt allows decoding integers as int rather than int64 when the target
+// is an interface{}, for example the values of a map[string]interface{}.
+func (d *Decoder) UseInt(v bool) *Decoder {
+	d.useInt = v
+	return d
+}
+
+// Lenient sets up the decoder to accept strings for boolean and numeric
+// fields, such as port = "8080", by parsing them into the type of the field.
+// Strings which do not parse are still reported as a conversion error.
+// Booleans are also accepted in any case, such as True or FALSE.
+func (d *Decoder) Lenient(v bool) *Decoder {
+	d.lenient = v
+	d.parserOptions.caseInsensitiveBools = v
+	return d
+}
+
+// DisallowTabs sets up the decoder to reject documents with lines indented by
+// tabs, for configurations which must only be indented with spaces. Tabs are
+// still accepted as whitespace elsewhere, such as around the equal sign.
+func (d *Decoder) DisallowTabs(v bool) *Decoder {
+	d.parserOptions.disallowTabs = v
+	return d
+}
+
+// DuplicateKeyPolicy is what the Decoder does with keys defined more than once
+// in the same table. See SetDuplicateKeyPolicy.
+type DuplicateKeyPolicy int
+
+// Policies the Decoder can apply to keys defined more than once.
+const (
+	// Reject the document.
+	DuplicateKeyError DuplicateKeyPolicy = iota
+	// Keep the first value of the key.
+	DuplicateKeyFirstWins
+	// Keep the last value of the key.
+	DuplicateKeyLastWins
+)
+
+// AllowDuplicateKeys sets up the decoder to accept keys defined more than once
+// in the same table, the last definition replacing the previous ones. Keys are
+// still not allowed to be defined both as values and as tables. It is a
+// shorthand for SetDuplicateKeyPolicy(DuplicateKeyLastWins), or
+// SetDuplicateKeyPolicy(DuplicateKeyError) if v is false.
+func (d *Decoder) AllowDuplicateKeys(v bool) *Decoder {
+	if v {
+		return d.SetDuplicateKeyPolicy(DuplicateKeyLastWins)
+	}
+	return d.SetDuplicateKeyPolicy(DuplicateKeyError)
+}
+
+// SetDuplicateKeyPolicy sets what the decoder does with keys defined more
+// than once in the same table, which is an error by default. Policies only
+// apply to values: a key defined both as a value and as a table is always an
+// error.
+func (d *Decoder) SetDuplicateKeyPolicy(policy DuplicateKeyPolicy) *Decoder {
+	d.parserOptions.duplicateKeys = policy
+	return d
+}
+
+// NormalizeKeys sets up the decoder to normalize every key of the document
+// with fn, for example to the Unicode normalization form NFC with
+// norm.NFC.String from golang.org/x/text/unicode/norm. Keys which only differ
+// before normalization, such as canonically equivalent keys, are then the
+// same key, and defining both is an error.
+func (d *Decoder) NormalizeKeys(fn func(string) string) *Decoder {
+	d.parserOptions.normalizeKey = fn
+	return d
+}
+
+// DisallowEmptyKeys sets up the decoder to reject documents with empty quoted
+// keys, such as "" = 1 or [a.''], which TOML allows but which are most likely
+// mistakes.
+func (d *Decoder) DisallowEmptyKeys(v bool) *Decoder {
+	d.parserOptions.disallowEmptyKeys = v
+	return d
+}
+
+// EmptyStringAsNil sets up the decoder to leave pointer to string fields nil
+// when their value is an empty string, rather than pointing to "".
+func (d *Decoder) EmptyStringAsNil(v bool) *Decoder {
+	d.emptyStringAsNil = v
+	return d
+}
+
+// SetArrayRootKey allows decoding into a pointer to a slice of structs or
+// maps. TOML documents cannot have an array at their root, so the document
+// must instead be made only of an array of tables named key, for example
+// [[item]] when key is "item", whose tables become the elements of the slice.
+func (d *Decoder) SetArrayRootKey(key string) *Decoder {
+	d.arrayRootKey = key
+	return d
+}
+
+// SetTimeLayouts sets the layouts, as understood by time.Parse, used to decode
+// string values into time.Time fields. Each layout is tried in order. TOML
+// datetime values are not affected.
+func (d *Decoder) SetTimeLayouts(layouts []string) *Decoder {
+	d.timeLayouts = layouts
+	return d
+}
+
+// ExpandEnv sets up the decoder to expand references to environment
+// variables, written ${VAR} or $VAR, in string values. Variables which are
+// not set expand to the empty string, unless StrictEnv is enabled.
+func (d *Decoder) ExpandEnv(v bool) *Decoder {
+	d.expandEnv = v
+	return d
+}
+
+// StrictEnv makes ExpandEnv return an error when a string value refers to an
+// environment variable that is not set.
+func (d *Decoder) StrictEnv(v bool) *Decoder {
+	d.strictEnv = v
+	return d
+}
+
 func (d *Decoder) unmarshal(v interface{}) error {
+	d.path = d.path[:0]
 	mtype := reflect.TypeOf(v)
-	if mtype.Kind() != reflect.Ptr || mtype.Elem().Kind() != reflect.Struct {
-		return errors.New("Only a pointer to struct can be unmarshaled from TOML")
+	if d.arrayRootKey != "" && mtype.Kind() == reflect.Ptr && isTreeSlice(mtype.Elem()) {
+		return d.unmarshalArrayRoot(v, mtype.Elem())
+	}
+	if mtype.Kind() != reflect.Ptr || (mtype.Elem().Kind() != reflect.Struct && mtype.Elem().Kind() != reflect.Map) {
+		return errors.New("Only a pointer to struct or map can be unmarshaled from TOML")
 	}
 
 	sval, err := d.valueFromTree(mtype.Elem(), d.tval)
@@ -526,19 +1294,73 @@ func (d *Decoder) unmarshal(v interface{}) error {
 	return nil
 }
 
+// Unmarshal a document made only of the array of tables named by the array
+// root key into the slice pointed at by v
+func (d *Decoder) unmarshalArrayRoot(v interface{}, mtype reflect.Type) error {
+	var tables []*Tree
+	for _, key := range d.tval.Keys() {
+		array, ok := d.tval.values[key].([]*Tree)
+		if key != d.arrayRootKey || !ok {
+			return formatError(fmt.Errorf("only the array of tables [[%s]] can be unmarshaled into a slice",
+				d.arrayRootKey), d.tval.GetPosition(key))
+		}
+		tables = array
+	}
+	d.pushKey(d.arrayRootKey)
+	sval, err := d.valueFromTreeSlice(mtype, tables)
+	if err != nil {
+		return err
+	}
+	d.popPath()
+	reflect.ValueOf(v).Elem().Set(sval)
+	return nil
+}
+
 // Convert toml tree to marshal struct or map, using marshal type
 func (d *Decoder) valueFromTree(mtype reflect.Type, tval *Tree) (reflect.Value, error) {
 	if mtype.Kind() == reflect.Ptr {
 		return d.unwrapPointer(mtype, tval)
 	}
+	if reflect.PtrTo(mtype).Implements(unmarshalerType) {
+		return d.callUnmarshaler(mtype, tval)
+	}
 	var mval reflect.Value
 	switch mtype.Kind() {
 	case reflect.Struct:
 		mval = reflect.New(mtype).Elem()
+		callDefaulter(mval)
+		if d.fieldResolver != nil {
+			matched := map[string]bool{}
+			for _, key := range tval.Keys() {
+				field, ok := d.fieldResolver(mtype, key)
+				if !ok {
+					continue
+				}
+				matched[key] = true
+				d.pushKey(key)
+				mvalf, err := d.valueFromToml(field.Type, tval.GetPath([]string{key}))
+				if err != nil {
+					return mval, formatError(err, tval.GetPosition(key))
+				}
+				d.popPath()
+				mval.FieldByIndex(field.Index).Set(mvalf)
+			}
+			if err := d.checkUnknownKeys(tval, matched); err != nil {
+				return mval, err
+			}
+			break
+		}
+		matched := map[string]bool{}
+		remain := -1
+		var oneofs oneofGroups
 		for i := 0; i < mtype.NumField(); i++ {
 			mtypef := mtype.Field(i)
 			an := annotation{tag: d.tagName}
 			opts := tomlOptions(mtypef, an)
+			if opts.include && opts.remain {
+				remain = i
+				continue
+			}
 			if opts.include {
 				baseKey := opts.name
 				keysToTry := []string{
@@ -547,6 +1369,12 @@ func (d *Decoder) valueFromTree(mtype reflect.Type, tval *Tree) (reflect.Value,
 					strings.ToTitle(baseKey),
 					strings.ToLower(string(baseKey[0])) + baseKey[1:],
 				}
+				// keys written in any other case match as well
+				for _, key := range tval.Keys() {
+					if strings.EqualFold(key, baseKey) {
+						keysToTry = append(keysToTry, key)
+					}
+				}
 
 				found := false
 				for _, key := range keysToTry {
@@ -555,72 +1383,278 @@ func (d *Decoder) valueFromTree(mtype reflect.Type, tval *Tree) (reflect.Value,
 						continue
 					}
 					val := tval.Get(key)
-					mvalf, err := d.valueFromToml(mtypef.Type, val)
+					var mvalf reflect.Value
+					var err error
+					d.pushKey(key)
+					if opts.embedded {
+						mvalf, err = d.valueFromEmbedded(mtypef.Type, val)
+					} else if mtypef.Type == rawMessageType {
+						mvalf, err = d.rawMessage(tval, key)
+					} else {
+						mvalf, err = d.valueFromToml(mtypef.Type, val)
+					}
+					if err == nil && opts.validate != "" {
+						err = d.callValidator(opts.validate, mvalf)
+					}
 					if err != nil {
 						return mval, formatError(err, tval.GetPosition(key))
 					}
+					d.popPath()
 					mval.Field(i).Set(mvalf)
+					matched[key] = true
 					found = true
 					break
 				}
+				if opts.oneof != "" {
+					oneofs.add(opts.oneof, opts.name, found)
+				}
 
-				if !found && opts.defaultValue != "" {
-					mvalf := mval.Field(i)
-					var val interface{}
-					var err error
-					switch mvalf.Kind() {
-					case reflect.Bool:
-						val, err = strconv.ParseBool(opts.defaultValue)
-						if err != nil {
-							return mval.Field(i), err
-						}
-					case reflect.Int:
-						val, err = strconv.Atoi(opts.defaultValue)
-						if err != nil {
-							return mval.Field(i), err
-						}
-					case reflect.String:
-						val = opts.defaultValue
-					case reflect.Int64:
-						val, err = strconv.ParseInt(opts.defaultValue, 10, 64)
-						if err != nil {
-							return mval.Field(i), err
-						}
-					case reflect.Float64:
-						val, err = strconv.ParseFloat(opts.defaultValue, 64)
-						if err != nil {
-							return mval.Field(i), err
-						}
-					default:
-						return mval.Field(i), fmt.Errorf("unsuported field type for default option")
+				if !found && opts.defaultFn != "" {
+					val, err := d.callDefaultFunc(mtypef.Type, opts.defaultFn)
+					if err != nil {
+						return mval.Field(i), err
+					}
+					mval.Field(i).Set(val)
+				} else if !found && opts.defaultValue != "" {
+					val, err := parseDefaultValue(mval.Field(i).Kind(), opts.defaultValue)
+					if err != nil {
+						return mval.Field(i), err
 					}
 					mval.Field(i).Set(reflect.ValueOf(val))
 				}
 			}
 		}
+		if remain >= 0 {
+			if err := d.setRemainingKeys(mval.Field(remain), tval, matched); err != nil {
+				return mval, err
+			}
+		} else if err := d.checkUnknownKeys(tval, matched); err != nil {
+			return mval, err
+		}
+		if err := oneofs.check(d.currentPath()); err != nil {
+			return mval, err
+		}
 	case reflect.Map:
 		mval = reflect.MakeMap(mtype)
 		for _, key := range tval.Keys() {
 			// TODO: path splits key
 			val := tval.GetPath([]string{key})
-			mvalf, err := d.valueFromToml(mtype.Elem(), val)
+			d.pushKey(key)
+			var mvalf reflect.Value
+			var err error
+			if mtype.Elem() == rawMessageType {
+				mvalf, err = d.rawMessage(tval, key)
+			} else {
+				mvalf, err = d.valueFromToml(mtype.Elem(), val)
+			}
 			if err != nil {
 				return mval, formatError(err, tval.GetPosition(key))
 			}
-			mval.SetMapIndex(reflect.ValueOf(key), mvalf)
+			d.popPath()
+			mkey, err := mapKeyFromToml(mtype.Key(), key)
+			if err != nil {
+				return mval, formatError(err, tval.GetPosition(key))
+			}
+			mval.SetMapIndex(mkey, mvalf)
+		}
+	}
+	if mtype.Kind() == reflect.Struct && mval.Addr().Type().Implements(validatableType) {
+		if err := mval.Addr().Interface().(Validatable).Validate(); err != nil {
+			return mval, err
 		}
 	}
 	return mval, nil
 }
 
+// Convert a toml key to the key type of a map: key types implementing
+// encoding.TextUnmarshaler are unmarshaled from the key, and integer key types
+// are parsed from it
+func mapKeyFromToml(ktype reflect.Type, key string) (reflect.Value, error) {
+	if reflect.PtrTo(ktype).Implements(textUnmarshalerType) {
+		return callTextUnmarshaler(ktype, key)
+	}
+	switch ktype.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(key).Convert(ktype), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(key, 10, ktype.Bits())
+		if err != nil {
+			return reflect.ValueOf(nil), fmt.Errorf("Can't convert key %s to %v. %s", key, ktype, err)
+		}
+		return reflect.ValueOf(n).Convert(ktype), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(key, 10, ktype.Bits())
+		if err != nil {
+			return reflect.ValueOf(nil), fmt.Errorf("Can't convert key %s to %v. %s", key, ktype, err)
+		}
+		return reflect.ValueOf(n).Convert(ktype), nil
+	default:
+		return reflect.ValueOf(nil), fmt.Errorf("Can't convert key %s to %v", key, ktype)
+	}
+}
+
+// the fields of a struct tagged with the oneof option, by group
+type oneofGroups struct {
+	names   []string            // in order of first appearance
+	keys    map[string][]string // keys of the fields of each group
+	defined map[string][]string // keys defined by the document
+}
+
+func (g *oneofGroups) add(group, key string, defined bool) {
+	if g.keys == nil {
+		g.keys = map[string][]string{}
+		g.defined = map[string][]string{}
+	}
+	if _, ok := g.keys[group]; !ok {
+		g.names = append(g.names, group)
+	}
+	g.keys[group] = append(g.keys[group], key)
+	if defined {
+		g.defined[group] = append(g.defined[group], key)
+	}
+}
+
+// Returns an error for the first group which does not have exactly one of
+// its fields defined in the table at path
+func (g *oneofGroups) check(path string) error {
+	for _, group := range g.names {
+		defined := g.defined[group]
+		if len(defined) == 1 {
+			continue
+		}
+		msg := "exactly one of " + strings.Join(g.keys[group], ", ") + " must be defined"
+		if path != "" {
+			msg += " in " + path
+		}
+		if len(defined) == 0 {
+			return errors.New(msg + ", got none")
+		}
+		return errors.New(msg + ", got " + strings.Join(defined, " and "))
+	}
+	return nil
+}
+
+// Decode the TOML document embedded in a string value into a struct or map
+// type, for fields tagged with the embedded option
+func (d *Decoder) valueFromEmbedded(mtype reflect.Type, tval interface{}) (reflect.Value, error) {
+	s, ok := tval.(string)
+	if !ok {
+		return reflect.ValueOf(nil), fmt.Errorf("Can't decode embedded TOML from %v(%T), expected a string", tval, tval)
+	}
+	if !isTree(indirectType(mtype)) {
+		return reflect.ValueOf(nil), fmt.Errorf("Can't decode embedded TOML into %v, expected a struct or a map", mtype)
+	}
+	tree, err := loadBytes([]byte(s), d.parserOptions)
+	if err != nil {
+		return reflect.ValueOf(nil), fmt.Errorf("embedded TOML: %s", err)
+	}
+	// the spans of the embedded document are relative to its own source
+	source := d.source
+	d.source = stripBOM([]byte(s))
+	defer func() { d.source = source }()
+	return d.valueFromTree(mtype, tree)
+}
+
+// Capture the value of key in tval as a RawMessage, from its source text if
+// known
+func (d *Decoder) rawMessage(tval *Tree, key string) (reflect.Value, error) {
+	var span Span
+	switch node := tval.values[key].(type) {
+	case *tomlValue:
+		span = node.span
+	case *Tree:
+		span = node.span
+	case []*Tree:
+		return reflect.ValueOf(nil), errors.New("Can't capture an array of tables as a RawMessage")
+	}
+	if span != (Span{}) && span.End <= len(d.source) {
+		raw := make(RawMessage, span.End-span.Start)
+		copy(raw, d.source[span.Start:span.End])
+		return reflect.ValueOf(raw), nil
+	}
+
+	var buf bytes.Buffer
+	switch node := tval.values[key].(type) {
+	case *tomlValue:
+		repr, err := tomlValueStringRepresentation(node, "", 0)
+		if err != nil {
+			return reflect.ValueOf(nil), err
+		}
+		buf.WriteString(repr)
+	case *Tree:
+		if _, err := node.WriteTo(&buf); err != nil {
+			return reflect.ValueOf(nil), err
+		}
+	}
+	return reflect.ValueOf(RawMessage(buf.Bytes())), nil
+}
+
+// Returns the type pointed to by mtype, through any number of pointers
+func indirectType(mtype reflect.Type) reflect.Type {
+	for mtype.Kind() == reflect.Ptr {
+		mtype = mtype.Elem()
+	}
+	return mtype
+}
+
+// Report the first key of tval, in alphabetical order, which was not matched to
+// a struct field, if unknown fields are disallowed
+func (d *Decoder) checkUnknownKeys(tval *Tree, matched map[string]bool) error {
+	if !d.disallowUnknown {
+		return nil
+	}
+	var unknown []string
+	for _, key := range tval.Keys() {
+		if !matched[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	d.pushKey(unknown[0])
+	path := d.currentPath()
+	d.popPath()
+	return formatError(fmt.Errorf("unknown field %s", path), tval.GetPosition(unknown[0]))
+}
+
+// Store the keys of tval that were not matched to a struct field in the map
+// field tagged with the remain option
+func (d *Decoder) setRemainingKeys(field reflect.Value, tval *Tree, matched map[string]bool) error {
+	ftype := field.Type()
+	if ftype.Kind() != reflect.Map || ftype.Key().Kind() != reflect.String {
+		return fmt.Errorf("remain field must be a map with string keys, got %v", ftype)
+	}
+	remaining := reflect.MakeMap(ftype)
+	for _, key := range tval.Keys() {
+		if matched[key] {
+			continue
+		}
+		d.pushKey(key)
+		val, err := d.valueFromToml(ftype.Elem(), tval.GetPath([]string{key}))
+		if err != nil {
+			return formatError(err, tval.GetPosition(key))
+		}
+		d.popPath()
+		remaining.SetMapIndex(reflect.ValueOf(key).Convert(ftype.Key()), val)
+	}
+	if remaining.Len() > 0 {
+		field.Set(remaining)
+	}
+	return nil
+}
+
 // Convert toml value to marshal struct/map slice, using marshal type
 func (d *Decoder) valueFromTreeSlice(mtype reflect.Type, tval []*Tree) (reflect.Value, error) {
 	mval := reflect.MakeSlice(mtype, len(tval), len(tval))
 	for i := 0; i < len(tval); i++ {
+		d.pushIndex(i)
 		val, err := d.valueFromTree(mtype.Elem(), tval[i])
 		if err != nil {
 			return mval, err
 		}
+		d.popPath()
 		mval.Index(i).Set(val)
 	}
 	return mval, nil
@@ -630,20 +1664,124 @@ func (d *Decoder) valueFromTreeSlice(mtype reflect.Type, tval []*Tree) (reflect.
 func (d *Decoder) valueFromOtherSlice(mtype reflect.Type, tval []interface{}) (reflect.Value, error) {
 	mval := reflect.MakeSlice(mtype, len(tval), len(tval))
 	for i := 0; i < len(tval); i++ {
+		d.pushIndex(i)
 		val, err := d.valueFromToml(mtype.Elem(), tval[i])
 		if err != nil {
 			return mval, err
 		}
+		d.popPath()
 		mval.Index(i).Set(val)
 	}
 	return mval, nil
 }
 
+// Convert toml value to its generic Go representation, as used when the
+// marshal type is interface{}
+func (d *Decoder) valueFromGeneric(tval interface{}) (interface{}, error) {
+	switch t := tval.(type) {
+	case *Tree:
+		result := map[string]interface{}{}
+		for _, key := range t.Keys() {
+			val, err := d.valueFromGeneric(t.GetPath([]string{key}))
+			if err != nil {
+				return nil, formatError(err, t.GetPosition(key))
+			}
+			result[key] = val
+		}
+		return result, nil
+	case []*Tree:
+		result := make([]interface{}, len(t))
+		for i, item := range t {
+			val, err := d.valueFromGeneric(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = val
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for i, item := range t {
+			val, err := d.valueFromGeneric(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = val
+		}
+		return result, nil
+	case int64:
+		if d.useInt {
+			return int(t), nil
+		}
+		return t, nil
+	case string:
+		return d.expandString(t)
+	default:
+		return t, nil
+	}
+}
+
+// Expand references to environment variables in a string value, if enabled
+func (d *Decoder) expandString(s string) (string, error) {
+	if !d.expandEnv {
+		return s, nil
+	}
+	var err error
+	expanded := os.Expand(s, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok && d.strictEnv && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value
+	})
+	return expanded, err
+}
+
 // Convert toml value to marshal value, using marshal type
 func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}) (reflect.Value, error) {
 	if mtype.Kind() == reflect.Ptr {
 		return d.unwrapPointer(mtype, tval)
 	}
+	if mtype.Kind() == reflect.Interface {
+		if mtype.NumMethod() != 0 {
+			return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to %v", tval, tval, mtype.String())
+		}
+		val, err := d.valueFromGeneric(tval)
+		if err != nil {
+			return reflect.ValueOf(nil), err
+		}
+		return reflect.ValueOf(val), nil
+	}
+	if reflect.PtrTo(mtype).Implements(unmarshalerType) {
+		return d.callUnmarshaler(mtype, tval)
+	}
+	switch t := tval.(type) {
+	case Integer:
+		if mtype == integerType {
+			return reflect.ValueOf(t), nil
+		}
+		tval = t.Value
+	case int64:
+		if mtype == integerType {
+			return reflect.ValueOf(Integer{Value: t, Radix: 10}), nil
+		}
+	}
+	if s, ok := tval.(string); ok {
+		expanded, err := d.expandString(s)
+		if err != nil {
+			return reflect.ValueOf(nil), err
+		}
+		tval = expanded
+		if mtype == timeType && len(d.timeLayouts) > 0 {
+			return d.parseTime(expanded)
+		}
+		if values, ok := d.enums[mtype]; ok {
+			return enumValue(mtype, values, expanded)
+		}
+		if reflect.PtrTo(mtype).Implements(textUnmarshalerType) {
+			return callTextUnmarshaler(mtype, expanded)
+		}
+	}
 
 	switch t := tval.(type) {
 	case *Tree:
@@ -657,11 +1795,14 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}) (reflect.V
 		}
 		return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to trees", tval, tval)
 	case []interface{}:
-		if isOtherSlice(mtype) {
+		if isOtherSlice(mtype) || isInterfaceSlice(mtype) || isTextUnmarshalerSlice(mtype) {
 			return d.valueFromOtherSlice(mtype, t)
 		}
 		return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to a slice", tval, tval)
 	default:
+		if s, ok := tval.(string); ok && d.lenient {
+			tval = parseLenient(mtype, s)
+		}
 		switch mtype.Kind() {
 		case reflect.Bool, reflect.Struct:
 			val := reflect.ValueOf(tval)
@@ -702,7 +1843,7 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}) (reflect.V
 				return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to %v", tval, tval, mtype.String())
 			}
 
-			if val.Convert(reflect.TypeOf(int(1))).Int() < 0 {
+			if val.Kind() != reflect.Uint64 && val.Convert(reflect.TypeOf(int(1))).Int() < 0 {
 				return reflect.ValueOf(nil), fmt.Errorf("%v(%T) is negative so does not fit in %v", tval, tval, mtype.String())
 			}
 			if reflect.Indirect(reflect.New(mtype)).OverflowUint(uint64(val.Convert(mtype).Uint())) {
@@ -718,6 +1859,9 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}) (reflect.V
 			if reflect.Indirect(reflect.New(mtype)).OverflowFloat(val.Convert(mtype).Float()) {
 				return reflect.ValueOf(nil), fmt.Errorf("%v(%T) would overflow %v", tval, tval, mtype.String())
 			}
+			if d.onLossyConversion != nil && isLossyFloatConversion(val, val.Convert(mtype)) {
+				d.onLossyConversion(d.currentPath(), val.Type().String(), mtype.String())
+			}
 
 			return val.Convert(mtype), nil
 		default:
@@ -726,7 +1870,97 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}) (reflect.V
 	}
 }
 
+// Reports whether converting the number val to the float converted lost
+// precision
+func isLossyFloatConversion(val, converted reflect.Value) bool {
+	f := converted.Float()
+	switch val.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return f != val.Float() && !math.IsNaN(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// 2^63 does not fit in an int64, and is the result of rounding the
+		// largest int64 values
+		return f >= math.MaxInt64 || int64(f) != val.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return f >= math.MaxUint64 || uint64(f) != val.Uint()
+	default:
+		return false
+	}
+}
+
+// Parse a string value into a time.Time, trying each of the time layouts in
+// order
+func (d *Decoder) parseTime(s string) (reflect.Value, error) {
+	for _, layout := range d.timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return reflect.ValueOf(t), nil
+		}
+	}
+	return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(string) to time.Time: no matching time layout", s)
+}
+
+// Decode a string value into a new value of mtype, whose pointer implements
+// encoding.TextUnmarshaler
+func callTextUnmarshaler(mtype reflect.Type, s string) (reflect.Value, error) {
+	mval := reflect.New(mtype)
+	if err := mval.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+		return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(string) to %v. %s", s, mtype.String(), err)
+	}
+	return mval.Elem(), nil
+}
+
+// Unmarshal a toml value into a new value of a type implementing Unmarshaler
+func (d *Decoder) callUnmarshaler(mtype reflect.Type, tval interface{}) (reflect.Value, error) {
+	val, err := d.valueFromGeneric(tval)
+	if err != nil {
+		return reflect.ValueOf(nil), err
+	}
+	mval := reflect.New(mtype)
+	if err := mval.Interface().(Unmarshaler).UnmarshalTOML(val); err != nil {
+		return reflect.ValueOf(nil), err
+	}
+	return mval.Elem(), nil
+}
+
+// Parse a string value into the TOML type matching the boolean or numeric
+// marshal type, for Lenient decoding. The string is returned unchanged if it
+// does not parse, or if the marshal type is not boolean or numeric.
+//
+// Integers are parsed directly as int64, or uint64 for unsigned types, never
+// through a float64, so that values above 2^53 keep their full precision.
+// Negative values for unsigned types are parsed as int64, to be reported as
+// out of range.
+func parseLenient(mtype reflect.Type, s string) interface{} {
+	var val interface{}
+	var err error
+	switch mtype.Kind() {
+	case reflect.Bool:
+		val, err = strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if mtype == reflect.TypeOf(time.Duration(1)) {
+			return s
+		}
+		val, err = strconv.ParseInt(s, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		val, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			val, err = strconv.ParseInt(s, 10, 64)
+		}
+	case reflect.Float32, reflect.Float64:
+		val, err = strconv.ParseFloat(s, 64)
+	default:
+		return s
+	}
+	if err != nil {
+		return s
+	}
+	return val
+}
+
 func (d *Decoder) unwrapPointer(mtype reflect.Type, tval interface{}) (reflect.Value, error) {
+	if d.emptyStringAsNil && mtype.Elem().Kind() == reflect.String && tval == "" {
+		return reflect.Zero(mtype), nil
+	}
 	val, err := d.valueFromToml(mtype.Elem(), tval)
 	if err != nil {
 		return reflect.ValueOf(nil), err
@@ -736,6 +1970,24 @@ func (d *Decoder) unwrapPointer(mtype reflect.Type, tval interface{}) (reflect.V
 	return mval, nil
 }
 
+// Parse the value of a default tag for a field of the given kind
+func parseDefaultValue(kind reflect.Kind, value string) (interface{}, error) {
+	switch kind {
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+	case reflect.Int:
+		return strconv.Atoi(value)
+	case reflect.String:
+		return value, nil
+	case reflect.Int64:
+		return strconv.ParseInt(value, 10, 64)
+	case reflect.Float64:
+		return strconv.ParseFloat(value, 64)
+	default:
+		return nil, fmt.Errorf("unsuported field type for default option")
+	}
+}
+
 func tomlOptions(vf reflect.StructField, an annotation) tomlOpts {
 	tag := vf.Tag.Get(an.tag)
 	parse := strings.Split(tag, ",")
@@ -765,8 +2017,24 @@ func tomlOptions(vf reflect.StructField, an annotation) tomlOpts {
 	if vf.PkgPath != "" {
 		result.include = false
 	}
-	if len(parse) > 1 && strings.Trim(parse[1], " ") == "omitempty" {
-		result.omitempty = true
+	for _, opt := range parse[1:] {
+		switch strings.Trim(opt, " ") {
+		case "omitempty":
+			result.omitempty = true
+		case "remain":
+			result.remain = true
+		case "embedded":
+			result.embedded = true
+		default:
+			trimmed := strings.Trim(opt, " ")
+			if strings.HasPrefix(trimmed, "defaultFn=") {
+				result.defaultFn = strings.TrimPrefix(trimmed, "defaultFn=")
+			} else if strings.HasPrefix(trimmed, "oneof=") {
+				result.oneof = strings.TrimPrefix(trimmed, "oneof=")
+			} else if strings.HasPrefix(trimmed, "validate=") {
+				result.validate = strings.TrimPrefix(trimmed, "validate=")
+			}
+		}
 	}
 	if vf.Type.Kind() == reflect.Ptr {
 		result.omitempty = true
@@ -791,5 +2059,5 @@ func formatError(err error, pos Position) error {
 	if err.Error()[0] == '(' { // Error already contains position information
 		return err
 	}
-	return fmt.Errorf("%s: %s", pos, err)
+	return &DecodeError{pos, err.Error()}
 }
@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"net"
+	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -925,6 +929,40 @@ func TestMarshalArrayOnePerLine(t *testing.T) {
 	}
 }
 
+func TestMarshalArrayWrap(t *testing.T) {
+	expected := []byte(`Long = [
+  1,
+  2,
+  3,
+  4,
+]
+Nested = [[1,2],[3]]
+Short = [1,2,3]
+`)
+
+	m := struct {
+		Short  []int64
+		Long   []int64
+		Nested [][]int64
+	}{
+		Short:  []int64{1, 2, 3},
+		Long:   []int64{1, 2, 3, 4},
+		Nested: [][]int64{{1, 2}, {3}},
+	}
+
+	var buf bytes.Buffer
+	err := NewEncoder(&buf).SetArrayWrap(3).Encode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+
+	if !bytes.Equal(b, expected) {
+		t.Errorf("Bad arrays marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, b)
+	}
+}
+
 var customTagTestToml = []byte(`
 [postgres]
   password = "bvalue"
@@ -1107,7 +1145,7 @@ func TestUnmarshalMap(t *testing.T) {
 	m["a"] = 1
 
 	err := Unmarshal(basicTestToml, m)
-	if err.Error() != "Only a pointer to struct can be unmarshaled from TOML" {
+	if err.Error() != "Only a pointer to struct or map can be unmarshaled from TOML" {
 		t.Fail()
 	}
 }
@@ -1307,6 +1345,305 @@ func TestUnmarshalDefault(t *testing.T) {
 	}
 }
 
+func TestUnmarshalDefaultFunc(t *testing.T) {
+	type config struct {
+		ID      string        `toml:"id,defaultFn=newID"`
+		Created time.Time     `toml:"created,defaultFn=now"`
+		Name    string        `toml:"name,defaultFn=newID" default:"unused"`
+		Timeout time.Duration `toml:"timeout,defaultFn=timeout"`
+	}
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	ids := 0
+	decoder := func(doc string) *Decoder {
+		return NewDecoder(strings.NewReader(doc)).
+			RegisterDefaultFunc("newID", func() interface{} {
+				ids++
+				return fmt.Sprintf("id-%d", ids)
+			}).
+			RegisterDefaultFunc("now", func() interface{} { return created }).
+			RegisterDefaultFunc("timeout", func() interface{} { return int64(time.Second) })
+	}
+
+	var result config
+	if err := decoder(`name = "server"`).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expected := config{ID: "id-1", Created: created, Name: "server", Timeout: time.Second}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	result = config{}
+	err := NewDecoder(strings.NewReader(`name = "server"`)).Decode(&result)
+	if err == nil || err.Error() != "default function newID is not registered" {
+		t.Errorf("expected an unregistered function error, got %v", err)
+	}
+
+	var wrongType struct {
+		Count int `toml:"count,defaultFn=newID"`
+	}
+	err = decoder("").Decode(&wrongType)
+	if err == nil || err.Error() != "default function newID returned id-2(string), which can't be assigned to int" {
+		t.Errorf("expected a type error, got %v", err)
+	}
+}
+
+func TestUnmarshalValidator(t *testing.T) {
+	type config struct {
+		Server struct {
+			Host string `toml:"host"`
+			Port int    `toml:"port,validate=portRange" default:"70000"`
+		} `toml:"server"`
+	}
+	decoder := func(doc string) *Decoder {
+		return NewDecoder(strings.NewReader(doc)).RegisterValidator("portRange", func(v interface{}) error {
+			if port := v.(int); port < 1 || port > 65535 {
+				return fmt.Errorf("port %d is out of range", port)
+			}
+			return nil
+		})
+	}
+
+	var result config
+	if err := decoder("[server]\nhost = \"localhost\"\nport = 8080").Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Server.Port != 8080 {
+		t.Errorf("expected port 8080, got %d", result.Server.Port)
+	}
+
+	result = config{}
+	if err := decoder("[server]\nhost = \"localhost\"").Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Server.Port != 70000 {
+		t.Errorf("expected the default port to be kept, got %d", result.Server.Port)
+	}
+
+	err := decoder("[server]\nhost = \"localhost\"\nport = 70000").Decode(&result)
+	if err == nil || err.Error() != "(3, 1): invalid value for server.port: port 70000 is out of range" {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+
+	err = Unmarshal([]byte("[server]\nport = 80"), &result)
+	if err == nil || err.Error() != "(2, 1): validator portRange is not registered" {
+		t.Errorf("expected an unregistered validator error, got %v", err)
+	}
+}
+
+type severity int
+
+const (
+	severityDebug severity = iota
+	severityInfo
+	severityWarn
+)
+
+func TestUnmarshalEnum(t *testing.T) {
+	var result struct {
+		Level  severity   `toml:"level"`
+		Levels []severity `toml:"levels"`
+	}
+	decoder := func(doc string) *Decoder {
+		return NewDecoder(strings.NewReader(doc)).RegisterEnum(reflect.TypeOf(severityDebug), map[string]interface{}{
+			"debug":   severityDebug,
+			"info":    severityInfo,
+			"warn":    severityWarn,
+			"warning": 2,
+		})
+	}
+
+	if err := decoder(`level = "warn"` + "\n" + `levels = ["debug", "warning"]`).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Level != severityWarn || !reflect.DeepEqual(result.Levels, []severity{severityDebug, severityWarn}) {
+		t.Errorf("bad result: %+v", result)
+	}
+
+	err := decoder("\n" + `level = "verbose"`).Decode(&result)
+	expected := `(2, 1): unknown toml.severity value "verbose", expected one of: debug, info, warn, warning`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+type percent int
+
+func (p *percent) UnmarshalTOML(v interface{}) error {
+	i, ok := v.(int64)
+	if !ok || i < 0 || i > 100 {
+		return fmt.Errorf("invalid percentage %v", v)
+	}
+	*p = percent(i)
+	return nil
+}
+
+type endpoint struct {
+	address string
+}
+
+func (e *endpoint) UnmarshalTOML(v interface{}) error {
+	table, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected a table, got %T", v)
+	}
+	e.address = fmt.Sprintf("%v:%v", table["host"], table["port"])
+	return nil
+}
+
+type endpointList []string
+
+func (l *endpointList) UnmarshalTOML(v interface{}) error {
+	for _, table := range v.([]interface{}) {
+		*l = append(*l, table.(map[string]interface{})["host"].(string))
+	}
+	return nil
+}
+
+func TestUnmarshalUnmarshaler(t *testing.T) {
+	var result struct {
+		Ratio     percent
+		Ratios    []percent
+		Optional  *percent
+		Server    endpoint
+		Endpoints endpointList
+	}
+	doc := []byte(`ratio = 50
+ratios = [10, 20]
+optional = 30
+[server]
+host = "localhost"
+port = 80
+[[endpoints]]
+host = "a"
+[[endpoints]]
+host = "b"
+`)
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Ratio != 50 || !reflect.DeepEqual(result.Ratios, []percent{10, 20}) ||
+		result.Optional == nil || *result.Optional != 30 {
+		t.Errorf("bad percentages: %+v", result)
+	}
+	if result.Server.address != "localhost:80" {
+		t.Errorf("bad table: %+v", result.Server)
+	}
+	if !reflect.DeepEqual(result.Endpoints, endpointList{"a", "b"}) {
+		t.Errorf("bad array of tables: %v", result.Endpoints)
+	}
+
+	var root endpoint
+	if err := Unmarshal([]byte("host = \"example.com\"\nport = 443\n"), &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.address != "example.com:443" {
+		t.Errorf("bad root: %+v", root)
+	}
+
+	err := Unmarshal([]byte("ratio = 150\n"), &result)
+	if err == nil || err.Error() != "(1, 1): invalid percentage 150" {
+		t.Errorf("expected an out of range error, got %v", err)
+	}
+}
+
+func TestUnmarshalRawMessage(t *testing.T) {
+	var result struct {
+		Limit   RawMessage
+		Options RawMessage
+		Plugin  struct {
+			Name   string
+			Config RawMessage
+		}
+		Extra map[string]RawMessage
+	}
+	doc := []byte(`limit = 0x10 # hexadecimal
+options = { verbose = true, level = "debug" }
+[plugin]
+name = "cache"
+[plugin.config]
+size = 128
+[plugin.config.eviction]
+policy = "lru"
+[extra]
+dates = [1979-05-27, 1980-01-01]
+`)
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Limit) != "0x10" {
+		t.Errorf("bad raw value: %q", result.Limit)
+	}
+	if string(result.Options) != `{ verbose = true, level = "debug" }` {
+		t.Errorf("bad raw inline table: %q", result.Options)
+	}
+	if string(result.Extra["dates"]) != "[1979-05-27, 1980-01-01]" {
+		t.Errorf("bad raw map value: %q", result.Extra["dates"])
+	}
+
+	var config struct {
+		Size     int
+		Eviction struct {
+			Policy string
+		}
+	}
+	if err := Unmarshal(result.Plugin.Config, &config); err != nil {
+		t.Fatalf("can't decode raw table %q: %s", result.Plugin.Config, err)
+	}
+	if result.Plugin.Name != "cache" || config.Size != 128 || config.Eviction.Policy != "lru" {
+		t.Errorf("bad raw table: %+v %+v", result.Plugin, config)
+	}
+
+	var array struct {
+		Items RawMessage
+	}
+	err := Unmarshal([]byte("[[items]]\nname = \"a\"\n"), &array)
+	if err == nil || err.Error() != "(1, 1): Can't capture an array of tables as a RawMessage" {
+		t.Errorf("expected an array of tables error, got %v", err)
+	}
+}
+
+func TestUnmarshalOneof(t *testing.T) {
+	type listener struct {
+		Port int
+	}
+	type config struct {
+		Name   string
+		Server struct {
+			TCP  *listener `toml:"tcp,oneof=transport"`
+			UDP  *listener `toml:"udp,oneof=transport"`
+			Unix string    `toml:"unix,oneof=transport"`
+		}
+	}
+
+	var result config
+	if err := Unmarshal([]byte("[server.udp]\nport = 53"), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Server.UDP == nil || result.Server.UDP.Port != 53 || result.Server.TCP != nil {
+		t.Errorf("bad decoded server: %+v", result.Server)
+	}
+
+	for doc, expected := range map[string]string{
+		"name = \"none\"\n[server]\n":                             "(2, 1): exactly one of tcp, udp, unix must be defined in server, got none",
+		"[server]\nunix = \"/tmp/sock\"\n[server.tcp]\nport = 80": "(1, 1): exactly one of tcp, udp, unix must be defined in server, got tcp and unix",
+	} {
+		err := Unmarshal([]byte(doc), &config{})
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", doc, expected, err)
+		}
+	}
+
+	var root struct {
+		File string `toml:"file,oneof=source"`
+		URL  string `toml:"url,oneof=source"`
+	}
+	err := Unmarshal([]byte(""), &root)
+	if err == nil || err.Error() != "exactly one of file, url must be defined, got none" {
+		t.Errorf("expected an error for the root table, got %v", err)
+	}
+}
+
 func TestUnmarshalDefaultFailureBool(t *testing.T) {
 	var doc struct {
 		Field bool `default:"blah"`
@@ -1361,3 +1698,1812 @@ func TestUnmarshalDefaultFailureUnsupported(t *testing.T) {
 		t.Fatal("should error")
 	}
 }
+
+func TestDecodeFlat(t *testing.T) {
+	doc := []byte(`
+title = "flat"
+[server]
+host = "localhost"
+ports = [80, 443]
+mixed = [1, { a = 2 }]
+[server.tls]
+enabled = true
+[server."a.b"]
+c = 1
+[[users]]
+name = "alice"
+[users.meta]
+admin = true
+`)
+	result, err := DecodeFlat(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"title":              "flat",
+		"server.host":        "localhost",
+		"server.ports":       []interface{}{int64(80), int64(443)},
+		"server.mixed":       []interface{}{int64(1), map[string]interface{}{"a": int64(2)}},
+		"server.tls.enabled": true,
+		`server."a.b".c`:     int64(1),
+		"users": []interface{}{
+			map[string]interface{}{
+				"name":       "alice",
+				"meta.admin": true,
+			},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Bad flat decode: expected\n%v\ngot\n%v", expected, result)
+	}
+}
+
+func TestUnmarshalGenericMap(t *testing.T) {
+	doc := []byte(`
+name = "generic"
+count = 3
+[server]
+ports = [80, 443]
+[[users]]
+name = "alice"
+`)
+	result := map[string]interface{}{}
+	err := Unmarshal(doc, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"name":  "generic",
+		"count": int64(3),
+		"server": map[string]interface{}{
+			"ports": []interface{}{int64(80), int64(443)},
+		},
+		"users": []interface{}{
+			map[string]interface{}{"name": "alice"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Bad unmarshal: expected\n%v\ngot\n%v", expected, result)
+	}
+}
+
+func TestUnmarshalUseInt(t *testing.T) {
+	doc := []byte("count = 3\nports = [80]")
+
+	for _, useInt := range []bool{false, true} {
+		var result struct {
+			Count interface{}
+			Ports interface{}
+		}
+		err := NewDecoder(bytes.NewReader(doc)).UseInt(useInt).Decode(&result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected, expectedPort interface{} = int64(3), int64(80)
+		if useInt {
+			expected, expectedPort = 3, 80
+		}
+		if result.Count != expected {
+			t.Errorf("UseInt(%t): expected %T, got %T", useInt, expected, result.Count)
+		}
+		if ports := result.Ports.([]interface{}); ports[0] != expectedPort {
+			t.Errorf("UseInt(%t): expected %T in array, got %T", useInt, expectedPort, ports[0])
+		}
+	}
+}
+
+func TestDecodeDelta(t *testing.T) {
+	baseline := map[string]interface{}{
+		"title": "delta",
+		"server": map[string]interface{}{
+			"host":  "localhost",
+			"port":  int64(80),
+			"ports": []interface{}{int64(80), int64(443)},
+		},
+		"removed": true,
+	}
+	doc := []byte(`
+title = "delta"
+[server]
+host = "example.com"
+port = 80
+ports = [80, 443]
+[client]
+timeout = 5
+`)
+	changed, err := DecodeDelta(doc, baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"server": map[string]interface{}{
+			"host": "example.com",
+		},
+		"client": map[string]interface{}{
+			"timeout": int64(5),
+		},
+	}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("Bad delta: expected\n%v\ngot\n%v", expected, changed)
+	}
+}
+
+func TestDecodeRecordSpans(t *testing.T) {
+	doc := `title = "spans" # comment
+[server]
+ports = [ 80, 443 ]
+point = { x = 1 }
+[[users]]
+name = 'ünïcode'
+`
+	var result map[string]interface{}
+	d := NewDecoder(strings.NewReader(doc)).RecordSpans(true)
+	if err := d.Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"title":          `"spans"`,
+		"server.ports":   `[ 80, 443 ]`,
+		"server.point":   `{ x = 1 }`,
+		"server.point.x": `1`,
+		"users[0].name":  `'ünïcode'`,
+	}
+	spans := d.Spans()
+	if len(spans) != len(expected) {
+		t.Errorf("expected %d spans, got %v", len(expected), spans)
+	}
+	for key, text := range expected {
+		span, ok := spans[key]
+		if !ok {
+			t.Errorf("no span recorded for %s", key)
+			continue
+		}
+		if got := doc[span.Start:span.End]; got != text {
+			t.Errorf("span of %s: expected %q, got %q", key, text, got)
+		}
+	}
+
+	if NewDecoder(strings.NewReader(doc)).Spans() != nil {
+		t.Error("spans should not be recorded by default")
+	}
+}
+
+func TestDecodeKeepComments(t *testing.T) {
+	doc := `# document title
+# second line
+title = "comments" # trailing title
+
+# detached from server
+
+[server] # the server
+# host name
+host = "localhost"
+ports = [
+  80, # not kept
+] # after ports
+inline = { a = 1 } # after inline
+
+# first user
+[[users]]
+name = "tom"
+[[users]] # second user
+  # indented
+name = "ann"
+`
+	var result map[string]interface{}
+	d := NewDecoder(strings.NewReader(doc)).KeepComments(true)
+	if err := d.Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string][]string{
+		"title":         {"document title", "second line"},
+		"server":        nil,
+		"server.host":   {"host name"},
+		"server.ports":  nil,
+		"users[0]":      {"first user"},
+		"users[0].name": nil,
+		"users[1].name": {"indented"},
+	} {
+		if got := d.LeadingComments(path); !reflect.DeepEqual(got, expected) {
+			t.Errorf("leading comments of %s: expected %q, got %q", path, expected, got)
+		}
+	}
+	for path, expected := range map[string]string{
+		"title":         "trailing title",
+		"server":        "the server",
+		"server.host":   "",
+		"server.ports":  "after ports",
+		"server.inline": "after inline",
+		"users[0]":      "",
+		"users[1]":      "second user",
+	} {
+		if got := d.TrailingComment(path); got != expected {
+			t.Errorf("trailing comment of %s: expected %q, got %q", path, expected, got)
+		}
+	}
+
+	d = NewDecoder(strings.NewReader(doc))
+	if err := d.Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if d.LeadingComments("title") != nil || d.TrailingComment("title") != "" {
+		t.Error("comments should not be kept by default")
+	}
+}
+
+type exampleServer struct {
+	Host string `toml:"host" comment:"server host"`
+	Port int    `toml:"port" default:"8080"`
+}
+
+type exampleConfig struct {
+	Title   string          `toml:"title" comment:"document title" default:"example"`
+	Debug   bool            `toml:"debug"`
+	Ratio   float64         `toml:"ratio,omitempty"`
+	Started time.Time       `toml:"started"`
+	Tags    []string        `toml:"tags"`
+	Server  exampleServer   `toml:"server"`
+	Backup  *exampleServer  `toml:"backup"`
+	Users   []exampleServer `toml:"users"`
+}
+
+func TestExample(t *testing.T) {
+	expected := `
+# document title
+title = "example"
+debug = false
+ratio = 0.0
+started = 0001-01-01T00:00:00Z
+tags = []
+
+[server]
+
+  # server host
+  host = ""
+  port = 8080
+
+[backup]
+
+  # server host
+  host = ""
+  port = 8080
+
+[[users]]
+
+  # server host
+  host = ""
+  port = 8080
+`
+	result, err := Example(exampleConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != expected {
+		t.Errorf("Bad example output:\nexpected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, result)
+	}
+
+	config := exampleConfig{}
+	if err := Unmarshal(result, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Server.Port != 8080 || len(config.Users) != 1 {
+		t.Errorf("example output does not round trip: %+v", config)
+	}
+}
+
+func TestExampleNotStruct(t *testing.T) {
+	if _, err := Example(42); err == nil {
+		t.Error("expected an error for a non-struct example")
+	}
+}
+
+type exampleNode struct {
+	Name     string         `toml:"name"`
+	Parent   *exampleNode   `toml:"parent"`
+	Children []*exampleNode `toml:"children"`
+}
+
+type examplePort int
+
+func TestExampleRecursiveAndNamedTypes(t *testing.T) {
+	result, err := Example(struct {
+		Port examplePort `toml:"port" default:"8080"`
+		Root exampleNode `toml:"root"`
+	}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `port = 8080
+
+[root]
+  name = ""
+`
+	if string(result) != expected {
+		t.Errorf("Bad example output:\nexpected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, result)
+	}
+}
+
+type defaulterServer struct {
+	Host string `toml:"host"`
+	Port int    `toml:"port"`
+}
+
+func (s *defaulterServer) SetDefaults() {
+	s.Host = "localhost"
+	s.Port = 8080
+}
+
+type defaulterConfig struct {
+	Name    string          `toml:"name"`
+	Retries int             `toml:"retries"`
+	Primary defaulterServer `toml:"primary"`
+	Backup  defaulterServer `toml:"backup"`
+}
+
+func (c *defaulterConfig) SetDefaults() {
+	c.Name = "default"
+	c.Retries = 3
+}
+
+func TestUnmarshalDefaulter(t *testing.T) {
+	doc := []byte("retries = 5\n[primary]\nport = 9090\n")
+	result := defaulterConfig{}
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	expected := defaulterConfig{
+		Name:    "default",
+		Retries: 5,
+		Primary: defaulterServer{Host: "localhost", Port: 9090},
+		Backup:  defaulterServer{Host: "localhost", Port: 8080},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Bad unmarshal: expected %v, got %v", expected, result)
+	}
+}
+
+type validatableRange struct {
+	Min     int
+	Max     int
+	checked bool
+}
+
+func (r *validatableRange) Validate() error {
+	if r.Min > r.Max {
+		return fmt.Errorf("min %d is greater than max %d", r.Min, r.Max)
+	}
+	r.checked = true
+	return nil
+}
+
+type validatableConfig struct {
+	Name   string
+	Range  validatableRange
+	Ranges []validatableRange
+}
+
+func (c *validatableConfig) Validate() error {
+	if !c.Range.checked {
+		return fmt.Errorf("range validated after its parent")
+	}
+	if c.Name == "" && len(c.Ranges) > 0 {
+		return fmt.Errorf("ranges require a name")
+	}
+	return nil
+}
+
+func TestUnmarshalValidatable(t *testing.T) {
+	var result validatableConfig
+	doc := []byte("name = \"limits\"\n[range]\nmin = 1\nmax = 2\n[[ranges]]\nmin = 3\nmax = 3\n")
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Range.Max != 2 || len(result.Ranges) != 1 || !result.Ranges[0].checked {
+		t.Errorf("bad result: %+v", result)
+	}
+
+	for doc, expected := range map[string]string{
+		"[range]\nmin = 5\nmax = 2\n":                     "(1, 1): min 5 is greater than max 2",
+		"[range]\nmin = 1\nmax = 2\n[[ranges]]\nmax = -1": "(4, 1): min 0 is greater than max -1",
+		"[range]\nmin = 1\nmax = 2\n[[ranges]]\nmax = 1":  "ranges require a name",
+	} {
+		var result validatableConfig
+		err := Unmarshal([]byte(doc), &result)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", doc, expected, err)
+		}
+	}
+}
+
+type remainConfig struct {
+	Name   string
+	Port   int
+	Extras map[string]interface{} `toml:",remain"`
+}
+
+type badRemainConfig struct {
+	Name   string
+	Extras []string `toml:",remain"`
+}
+
+func TestUnmarshalRemain(t *testing.T) {
+	doc := []byte("name = \"web\"\nport = 80\ndebug = true\ntags = [\"a\", \"b\"]\n[limits]\nconns = 10\n")
+	result := remainConfig{}
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	expected := remainConfig{
+		Name: "web",
+		Port: 80,
+		Extras: map[string]interface{}{
+			"debug":  true,
+			"tags":   []interface{}{"a", "b"},
+			"limits": map[string]interface{}{"conns": int64(10)},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Bad unmarshal: expected %v, got %v", expected, result)
+	}
+
+	result = remainConfig{}
+	if err := Unmarshal([]byte("name = \"web\"\nport = 80\n"), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Extras != nil {
+		t.Errorf("expected no extras, got %v", result.Extras)
+	}
+
+	err := Unmarshal(doc, &badRemainConfig{})
+	if err == nil || err.Error() != "remain field must be a map with string keys, got []string" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+type embeddedPlugin struct {
+	Name    string
+	Options map[string]int
+}
+
+type embeddedConfig struct {
+	Title  string
+	Plugin embeddedPlugin  `toml:"plugin,embedded"`
+	Extra  *embeddedPlugin `toml:"extra,embedded"`
+}
+
+func TestUnmarshalEmbedded(t *testing.T) {
+	doc := []byte(`title = "outer"
+plugin = """
+name = "cache"
+[options]
+size = 10
+"""
+extra = '''
+name = "log"
+options = { level = 2 }'''
+`)
+	result := embeddedConfig{}
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	expected := embeddedConfig{
+		Title:  "outer",
+		Plugin: embeddedPlugin{Name: "cache", Options: map[string]int{"size": 10}},
+		Extra:  &embeddedPlugin{Name: "log", Options: map[string]int{"level": 2}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Bad unmarshal: expected %+v, got %+v", expected, result)
+	}
+
+	encoded, err := Marshal(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip := embeddedConfig{}
+	if err := Unmarshal(encoded, &roundTrip); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roundTrip, expected) {
+		t.Errorf("Bad round trip: expected %+v, got %+v from\n%s", expected, roundTrip, encoded)
+	}
+
+	for doc, expected := range map[string]string{
+		"plugin = 1":           "(1, 1): Can't decode embedded TOML from 1(int64), expected a string",
+		"plugin = \"name = \"": "(1, 1): embedded TOML: (1, 8): expecting a value",
+	} {
+		err := Unmarshal([]byte(doc), &embeddedConfig{})
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", doc, expected, err)
+		}
+	}
+}
+
+func TestDecodeOnLossyConversion(t *testing.T) {
+	var result struct {
+		Exact   float32
+		Ratio   float32
+		Big     float64
+		Samples []float32
+		Servers []struct {
+			Weight float32
+		}
+		Limits map[string]float32
+	}
+	doc := []byte("exact = 0.5\nratio = 0.1\nbig = 9007199254740993\nsamples = [1.5, 3.3]\n" +
+		"[[servers]]\nweight = 2.0\n[[servers]]\nweight = 0.7\n[limits]\n\"cpu.max\" = 1e-50\n")
+	var warnings []string
+	err := NewDecoder(bytes.NewReader(doc)).OnLossyConversion(func(path, from, to string) {
+		warnings = append(warnings, fmt.Sprintf("%s: %s -> %s", path, from, to))
+	}).Decode(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(warnings)
+	expected := []string{
+		"big: int64 -> float64",
+		"limits.\"cpu.max\": float64 -> float32",
+		"ratio: float64 -> float32",
+		"samples[1]: float64 -> float32",
+		"servers[1].weight: float64 -> float32",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected warnings %q, got %q", expected, warnings)
+	}
+	if result.Ratio != float32(0.1) || result.Big != 9007199254740992 {
+		t.Errorf("lossy values should still be decoded, got %+v", result)
+	}
+}
+
+type envConfig struct {
+	Path  string
+	Extra map[string]interface{}
+}
+
+func TestDecodeExpandEnv(t *testing.T) {
+	os.Setenv("GOTOML_TEST_HOME", "/home/tom")
+	defer os.Unsetenv("GOTOML_TEST_HOME")
+	os.Unsetenv("GOTOML_TEST_MISSING")
+	doc := []byte("path = \"${GOTOML_TEST_HOME}/data\"\n[extra]\nlog = \"$GOTOML_TEST_HOME/log\"\ncache = \"${GOTOML_TEST_MISSING}/cache\"\n")
+
+	result := envConfig{}
+	if err := NewDecoder(bytes.NewReader(doc)).ExpandEnv(true).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expected := envConfig{
+		Path: "/home/tom/data",
+		Extra: map[string]interface{}{
+			"log":   "/home/tom/log",
+			"cache": "/cache",
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Bad expansion: expected %v, got %v", expected, result)
+	}
+
+	result = envConfig{}
+	if err := NewDecoder(bytes.NewReader(doc)).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Path != "${GOTOML_TEST_HOME}/data" {
+		t.Errorf("expected no expansion by default, got %q", result.Path)
+	}
+}
+
+func TestDecodeExpandEnvStrict(t *testing.T) {
+	os.Unsetenv("GOTOML_TEST_MISSING")
+	doc := []byte("path = \"${GOTOML_TEST_MISSING}/data\"\n")
+
+	result := envConfig{}
+	err := NewDecoder(bytes.NewReader(doc)).ExpandEnv(true).StrictEnv(true).Decode(&result)
+	expected := "(1, 1): environment variable GOTOML_TEST_MISSING is not set"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+type resolverConfig struct {
+	ServerName string `cfg:"server_name"`
+	MaxConns   int    `cfg:"max_conns"`
+	Ignored    string
+}
+
+func TestDecodeFieldResolver(t *testing.T) {
+	resolver := func(mtype reflect.Type, key string) (reflect.StructField, bool) {
+		for i := 0; i < mtype.NumField(); i++ {
+			if field := mtype.Field(i); field.Tag.Get("cfg") == key {
+				return field, true
+			}
+		}
+		return reflect.StructField{}, false
+	}
+	doc := []byte("server_name = \"db\"\nmax_conns = 12\nIgnored = \"x\"\n")
+
+	result := resolverConfig{}
+	err := NewDecoder(bytes.NewReader(doc)).SetFieldResolver(resolver).Decode(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := resolverConfig{ServerName: "db", MaxConns: 12}
+	if result != expected {
+		t.Errorf("Bad decode: expected %v, got %v", expected, result)
+	}
+
+	doc = []byte("max_conns = \"many\"\n")
+	err = NewDecoder(bytes.NewReader(doc)).SetFieldResolver(resolver).Decode(&result)
+	if err == nil || !strings.HasPrefix(err.Error(), "(1, 1): ") {
+		t.Errorf("expected a positioned conversion error, got %v", err)
+	}
+}
+
+func TestDecodeAllowInlineTableTrailingComma(t *testing.T) {
+	doc := []byte("point = { x = 1, y = 2, }\n")
+	var result struct {
+		Point struct {
+			X int `toml:"x"`
+			Y int `toml:"y"`
+		} `toml:"point"`
+	}
+
+	err := NewDecoder(bytes.NewReader(doc)).Decode(&result)
+	if err == nil || err.Error() != "(1, 23): trailing comma at the end of inline table" {
+		t.Errorf("expected trailing comma error by default, got %v", err)
+	}
+
+	err = NewDecoder(bytes.NewReader(doc)).AllowInlineTableTrailingComma(true).Decode(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Point.X != 1 || result.Point.Y != 2 {
+		t.Errorf("Bad decode: %+v", result)
+	}
+}
+
+type lenientConfig struct {
+	Port    int
+	Enabled bool
+	Ratio   float32
+	Workers uint8
+	Timeout time.Duration
+}
+
+func TestDecodeLenient(t *testing.T) {
+	doc := []byte("port = \"8080\"\nenabled = \"true\"\nratio = \"0.5\"\nworkers = \"4\"\ntimeout = \"5s\"\n")
+
+	result := lenientConfig{}
+	if err := NewDecoder(bytes.NewReader(doc)).Lenient(true).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expected := lenientConfig{Port: 8080, Enabled: true, Ratio: 0.5, Workers: 4, Timeout: 5 * time.Second}
+	if result != expected {
+		t.Errorf("Bad lenient decode: expected %v, got %v", expected, result)
+	}
+
+	err := NewDecoder(bytes.NewReader(doc)).Decode(&lenientConfig{})
+	if err == nil || err.Error() != "(1, 1): Can't convert 8080(string) to int" {
+		t.Errorf("expected a conversion error by default, got %v", err)
+	}
+
+	err = NewDecoder(bytes.NewReader([]byte("workers = \"-1\"\n"))).Lenient(true).Decode(&lenientConfig{})
+	if err == nil || err.Error() != "(1, 1): -1(int64) is negative so does not fit in uint8" {
+		t.Errorf("expected a range error, got %v", err)
+	}
+
+	var large struct{ Count uint64 }
+	err = NewDecoder(bytes.NewReader([]byte("count = \"18446744073709551615\"\n"))).Lenient(true).Decode(&large)
+	if err != nil || large.Count != math.MaxUint64 {
+		t.Errorf("expected the largest uint64, got %d and %v", large.Count, err)
+	}
+}
+
+func TestDecodeLenientBooleans(t *testing.T) {
+	var result struct {
+		A bool
+		B bool
+		C []bool
+		D map[string]interface{}
+	}
+	doc := []byte("a = True\nb = FALSE\nc = [TRUE, false, fAlSe]\nd = { e = True }\n")
+	if err := NewDecoder(bytes.NewReader(doc)).Lenient(true).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.A || result.B || !reflect.DeepEqual(result.C, []bool{true, false, false}) ||
+		!reflect.DeepEqual(result.D, map[string]interface{}{"e": true}) {
+		t.Errorf("Bad lenient decode: %+v", result)
+	}
+
+	err := NewDecoder(bytes.NewReader(doc)).Decode(&result)
+	if err == nil || err.Error() != "(1, 5): boolean must be lowercase true, got True" {
+		t.Errorf("expected a case error by default, got %v", err)
+	}
+}
+
+func TestUnmarshalBool(t *testing.T) {
+	var result struct{ Enabled bool }
+	if err := Unmarshal([]byte("enabled = true"), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Enabled {
+		t.Errorf("expected enabled to be true")
+	}
+
+	for doc, expected := range map[string]string{
+		"enabled = True":  "(1, 11): boolean must be lowercase true, got True",
+		"enabled = TRUE":  "(1, 11): boolean must be lowercase true, got TRUE",
+		"enabled = truex": "(1, 11): invalid boolean truex",
+	} {
+		err := Unmarshal([]byte(doc), &result)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", doc, expected, err)
+		}
+	}
+}
+
+func TestUnmarshalDecimalInteger(t *testing.T) {
+	var cfg struct {
+		Port   int64
+		Offset int
+		Any    interface{}
+	}
+	if err := Unmarshal([]byte("port = 8080\noffset = -42 # comment\nany = +7"), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 8080 || cfg.Offset != -42 || cfg.Any != int64(7) {
+		t.Errorf("bad decoded integers: %+v", cfg)
+	}
+
+	err := Unmarshal([]byte("port = 08080"), &cfg)
+	if err == nil || err.Error() != "(1, 8): leading zeros are not allowed in integers" {
+		t.Errorf("expected a leading zeros error, got %v", err)
+	}
+}
+
+func TestUnmarshalFloats(t *testing.T) {
+	var result struct {
+		Pi       float64
+		Million  float64
+		Avogadro float64
+		Small    float64
+		Any      interface{}
+		Integer  interface{}
+	}
+	doc := []byte("pi = 3.14\nmillion = 1e6\navogadro = +6.022E23\nsmall = 2.5e-3\nany = -1.5\ninteger = 5")
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Pi != 3.14 || result.Million != 1e6 || result.Avogadro != 6.022e23 || result.Small != 0.0025 {
+		t.Errorf("bad decoded floats: %+v", result)
+	}
+	if result.Any != -1.5 {
+		t.Errorf("expected a float64, got %#v", result.Any)
+	}
+	if result.Integer != int64(5) {
+		t.Errorf("expected an int64, got %#v", result.Integer)
+	}
+}
+
+func TestUnmarshalOffsetDateTimes(t *testing.T) {
+	var result struct {
+		UTC     time.Time
+		Offset  time.Time
+		Space   time.Time
+		Precise time.Time
+	}
+	doc := []byte(`utc = 1979-05-27T07:32:00Z
+offset = 1979-05-27T07:32:00-08:00
+space = 1979-05-27 07:32:00.5+01:00
+precise = 1979-05-27T07:32:00.1234567891Z
+`)
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		actual, expected time.Time
+	}{
+		{result.UTC, time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)},
+		{result.Offset, time.Date(1979, 5, 27, 7, 32, 0, 0, time.FixedZone("", -8*3600))},
+		{result.Space, time.Date(1979, 5, 27, 7, 32, 0, 500000000, time.FixedZone("", 3600))},
+		{result.Precise, time.Date(1979, 5, 27, 7, 32, 0, 123456789, time.UTC)},
+	} {
+		if !test.actual.Equal(test.expected) {
+			t.Errorf("expected %v, got %v", test.expected, test.actual)
+		}
+		_, actualOffset := test.actual.Zone()
+		_, expectedOffset := test.expected.Zone()
+		if actualOffset != expectedOffset {
+			t.Errorf("expected the offset of %v, got %v", test.expected, test.actual)
+		}
+	}
+}
+
+func TestUnmarshalSpecialFloats(t *testing.T) {
+	var result struct {
+		Ratio   interface{}
+		Min     float64
+		Max     float32
+		Missing float64
+	}
+	if err := Unmarshal([]byte("ratio = nan\nmin = -inf\nmax = +inf\nmissing = -nan"), &result); err != nil {
+		t.Fatal(err)
+	}
+	if ratio, ok := result.Ratio.(float64); !ok || !math.IsNaN(ratio) {
+		t.Errorf("expected ratio to be NaN, got %#v", result.Ratio)
+	}
+	if !math.IsInf(result.Min, -1) || !math.IsInf(float64(result.Max), 1) || !math.IsNaN(result.Missing) {
+		t.Errorf("bad decoded floats: %+v", result)
+	}
+}
+
+func TestUnmarshalPrefixedIntegers(t *testing.T) {
+	var result struct {
+		Hex    int64
+		Octal  int64
+		Binary int64
+	}
+	if err := Unmarshal([]byte("hex = 0xFF\noctal = 0o755\nbinary = 0b1010"), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Hex != 255 || result.Octal != 493 || result.Binary != 10 {
+		t.Errorf("bad decoded integers: %+v", result)
+	}
+}
+
+func TestUnmarshalNumbersWithUnderscores(t *testing.T) {
+	var result struct {
+		Count    int64
+		Pi       float64
+		Exponent float64
+		Mask     uint32
+	}
+	doc := []byte("count = 1_000_000\npi = 3.141_592\nexponent = 1e1_0\nmask = 0xdead_beef")
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 1000000 || result.Pi != 3.141592 || result.Exponent != 1e10 || result.Mask != 0xdeadbeef {
+		t.Errorf("bad decoded numbers: %+v", result)
+	}
+
+	err := Unmarshal([]byte("count = 1__0"), &result)
+	if err == nil || err.Error() != "(1, 9): invalid use of _ in number" {
+		t.Errorf("expected an underscore error, got %v", err)
+	}
+}
+
+func TestUnmarshalHeterogeneousArray(t *testing.T) {
+	doc := []byte(`groups = [1, "admins", { name = "ops", ids = [2, { id = 3 }] }, [true, 1.5]]`)
+	expected := []interface{}{
+		int64(1),
+		"admins",
+		map[string]interface{}{
+			"name": "ops",
+			"ids":  []interface{}{int64(2), map[string]interface{}{"id": int64(3)}},
+		},
+		[]interface{}{true, 1.5},
+	}
+
+	var result struct{ Groups []interface{} }
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Groups, expected) {
+		t.Errorf("expected %#v, got %#v", expected, result.Groups)
+	}
+
+	var generic map[string]interface{}
+	if err := Unmarshal(doc, &generic); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(generic["groups"], expected) {
+		t.Errorf("expected %#v, got %#v", expected, generic["groups"])
+	}
+}
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelError
+)
+
+func (l *logLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = levelDebug
+	case "info":
+		*l = levelInfo
+	case "error":
+		*l = levelError
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+	return nil
+}
+
+func TestUnmarshalMapKeys(t *testing.T) {
+	var result struct {
+		Verbosity map[logLevel]int
+		Ports     map[uint16]string
+		Offsets   map[int8]bool
+	}
+	doc := []byte("[verbosity]\ndebug = 3\nerror = 1\n[ports]\n80 = \"http\"\n443 = \"https\"\n[offsets]\n-1 = true\n")
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Verbosity, map[logLevel]int{levelDebug: 3, levelError: 1}) {
+		t.Errorf("Bad enum keys: %v", result.Verbosity)
+	}
+	if !reflect.DeepEqual(result.Ports, map[uint16]string{80: "http", 443: "https"}) {
+		t.Errorf("Bad integer keys: %v", result.Ports)
+	}
+	if !reflect.DeepEqual(result.Offsets, map[int8]bool{-1: true}) {
+		t.Errorf("Bad integer keys: %v", result.Offsets)
+	}
+
+	err := Unmarshal([]byte("[verbosity]\ntrace = 4\n"), &result)
+	if err == nil || err.Error() != "(2, 1): Can't convert trace(string) to toml.logLevel. unknown level \"trace\"" {
+		t.Errorf("expected an UnmarshalText error, got %v", err)
+	}
+	err = Unmarshal([]byte("[ports]\n70000 = \"big\"\n"), &result)
+	if err == nil || err.Error() != "(2, 1): Can't convert key 70000 to uint16. strconv.ParseUint: parsing \"70000\": value out of range" {
+		t.Errorf("expected a range error, got %v", err)
+	}
+}
+
+func TestUnmarshalTextUnmarshalerSlice(t *testing.T) {
+	var result struct {
+		Gateway net.IP
+		Hosts   []net.IP
+	}
+	doc := []byte("gateway = \"10.0.0.1\"\nhosts = [\"1.2.3.4\", \"5.6.7.8\"]\n")
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	expected := []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("5.6.7.8")}
+	if !reflect.DeepEqual(result.Hosts, expected) {
+		t.Errorf("Bad unmarshal: expected %v, got %v", expected, result.Hosts)
+	}
+	if !result.Gateway.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Bad unmarshal: expected 10.0.0.1, got %v", result.Gateway)
+	}
+
+	err := Unmarshal([]byte("hosts = [\"1.2.3.4\", \"nope\"]\n"), &result)
+	if err == nil || err.Error() != "(1, 1): Can't convert nope(string) to net.IP. invalid IP address: nope" {
+		t.Errorf("expected an UnmarshalText error, got %v", err)
+	}
+}
+
+type timeout struct {
+	time.Duration
+}
+
+func (t *timeout) UnmarshalText(text []byte) error {
+	var err error
+	t.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+func TestUnmarshalTextUnmarshalerStruct(t *testing.T) {
+	var result struct {
+		Read     timeout
+		Retries  []timeout
+		Optional []*timeout
+		Limits   map[string]timeout
+	}
+	doc := []byte("read = \"5s\"\nretries = [\"1s\", \"2s\"]\noptional = [\"1m\"]\nlimits = { write = \"10s\" }\n")
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Read.Duration != 5*time.Second {
+		t.Errorf("Bad unmarshal: expected 5s, got %v", result.Read)
+	}
+	if !reflect.DeepEqual(result.Retries, []timeout{{time.Second}, {2 * time.Second}}) {
+		t.Errorf("Bad unmarshal: expected [1s 2s], got %v", result.Retries)
+	}
+	if len(result.Optional) != 1 || result.Optional[0].Duration != time.Minute {
+		t.Errorf("Bad unmarshal: expected [1m], got %v", result.Optional)
+	}
+	if result.Limits["write"].Duration != 10*time.Second {
+		t.Errorf("Bad unmarshal: expected 10s, got %v", result.Limits)
+	}
+
+	err := Unmarshal([]byte("read = 5\n"), &result)
+	if err == nil || err.Error() != "(1, 1): Can't convert 5(int64) to toml.timeout" {
+		t.Errorf("expected a conversion error, got %v", err)
+	}
+}
+
+func TestDecodeTimeLayouts(t *testing.T) {
+	var result struct {
+		Created time.Time
+		Updated time.Time
+		Native  time.Time
+	}
+	doc := []byte("created = \"02/01/2006 15:04\"\nupdated = \"2019-03-04\"\nnative = 1979-05-27T07:32:00Z\n")
+	layouts := []string{"02/01/2006 15:04", "2006-01-02"}
+	if err := NewDecoder(bytes.NewReader(doc)).SetTimeLayouts(layouts).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC); !result.Created.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, result.Created)
+	}
+	if expected := time.Date(2019, 3, 4, 0, 0, 0, 0, time.UTC); !result.Updated.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, result.Updated)
+	}
+	if expected := time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC); !result.Native.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, result.Native)
+	}
+
+	doc = []byte("created = \"yesterday\"\n")
+	err := NewDecoder(bytes.NewReader(doc)).SetTimeLayouts(layouts).Decode(&result)
+	if err == nil || err.Error() != "(1, 1): Can't convert yesterday(string) to time.Time: no matching time layout" {
+		t.Errorf("expected a layout error, got %v", err)
+	}
+}
+
+type sortedUser struct {
+	Name string `toml:"name"`
+	Age  int    `toml:"age"`
+}
+
+func TestEncoderSortTablesBy(t *testing.T) {
+	data := struct {
+		Users []sortedUser `toml:"users"`
+	}{
+		Users: []sortedUser{{"carol", 35}, {"alice", 41}, {"bob", 28}},
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).SortTablesBy("name").Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+[[users]]
+  age = 41
+  name = "alice"
+
+[[users]]
+  age = 28
+  name = "bob"
+
+[[users]]
+  age = 35
+  name = "carol"
+`
+	if buf.String() != expected {
+		t.Errorf("Bad sorted output:\nexpected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := NewEncoder(&buf).SortTablesBy("age").Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	if result := buf.String(); strings.Index(result, "bob") > strings.Index(result, "carol") ||
+		strings.Index(result, "carol") > strings.Index(result, "alice") {
+		t.Errorf("expected users ordered by age, got\n%s", result)
+	}
+
+	if data.Users[0].Name != "carol" {
+		t.Error("encoding should leave the encoded value unchanged")
+	}
+}
+
+func TestDecodeEmptyStringAsNil(t *testing.T) {
+	type config struct {
+		Name    *string
+		Comment *string
+		Host    string
+	}
+	doc := []byte("name = \"\"\ncomment = \"hello\"\nhost = \"\"\n")
+
+	result := config{}
+	if err := NewDecoder(bytes.NewReader(doc)).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Name == nil || *result.Name != "" {
+		t.Errorf("expected a pointer to an empty string by default, got %v", result.Name)
+	}
+
+	result = config{}
+	if err := NewDecoder(bytes.NewReader(doc)).EmptyStringAsNil(true).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != nil {
+		t.Errorf("expected nil, got %q", *result.Name)
+	}
+	if result.Comment == nil || *result.Comment != "hello" {
+		t.Errorf("expected a pointer to \"hello\", got %v", result.Comment)
+	}
+}
+
+func TestDecodeArrayRootKey(t *testing.T) {
+	type item struct {
+		Name  string
+		Price float64
+	}
+	doc := []byte("[[item]]\nname = \"hammer\"\nprice = 9.5\n\n[[item]]\nname = \"nail\"\nprice = 0.1\n")
+
+	var result []item
+	if err := NewDecoder(bytes.NewReader(doc)).SetArrayRootKey("item").Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expected := []item{{"hammer", 9.5}, {"nail", 0.1}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Bad decode: expected %v, got %v", expected, result)
+	}
+
+	doc = []byte("title = \"tools\"\n[[item]]\nname = \"hammer\"\n")
+	err := NewDecoder(bytes.NewReader(doc)).SetArrayRootKey("item").Decode(&result)
+	if err == nil || err.Error() != "(1, 1): only the array of tables [[item]] can be unmarshaled into a slice" {
+		t.Errorf("expected an error for extra keys, got %v", err)
+	}
+
+	err = NewDecoder(bytes.NewReader(doc)).Decode(&result)
+	if err == nil || err.Error() != "Only a pointer to struct or map can be unmarshaled from TOML" {
+		t.Errorf("expected slices to be rejected without a root key, got %v", err)
+	}
+}
+
+type emptyTableInner struct {
+	Name string `toml:"name,omitempty"`
+	skip string
+}
+
+type emptyTableConfig struct {
+	Title    string                       `toml:"title"`
+	Plain    emptyTableInner              `toml:"plain"`
+	Optional emptyTableInner              `toml:"optional,omitempty"`
+	Extra    map[string]map[string]string `toml:"extra"`
+}
+
+func TestEncoderEmptyTables(t *testing.T) {
+	data := emptyTableConfig{
+		Title:    "config",
+		Optional: emptyTableInner{skip: "not encoded"},
+		Extra:    map[string]map[string]string{"nested": {}},
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Order(OrderPreserve).Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	expected := `title = "config"
+
+[plain]
+
+[extra]
+
+  [extra.nested]
+`
+	if buf.String() != expected {
+		t.Errorf("Bad default output:\nexpected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := NewEncoder(&buf).OmitEmptyTables(true).Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	expected = "title = \"config\"\n"
+	if buf.String() != expected {
+		t.Errorf("Bad output omitting empty tables:\nexpected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+}
+
+type streamedServer struct {
+	Name  string `toml:"name"`
+	Ports []int  `toml:"ports"`
+	TLS   struct {
+		Enabled bool `toml:"enabled"`
+	} `toml:"tls"`
+}
+
+func TestEncoderStreamArrayOfTables(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf).Order(OrderPreserve)
+	if err := encoder.Encode(map[string]string{"title": "servers"}); err != nil {
+		t.Fatal(err)
+	}
+	write, closeStream := encoder.StreamArrayOfTables("servers")
+	servers := []streamedServer{
+		{Name: "alpha", Ports: []int{80}},
+		{Name: "beta", Ports: []int{80, 443}},
+		{Name: "gamma"},
+	}
+	servers[1].TLS.Enabled = true
+	for i := range servers {
+		if err := write(&servers[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := closeStream(); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(streamedServer{}); err == nil {
+		t.Error("expected an error writing to a closed stream")
+	}
+	if err := write(42); err == nil {
+		t.Error("expected an error writing a value which is not a table")
+	}
+
+	var result struct {
+		Title   string           `toml:"title"`
+		Servers []streamedServer `toml:"servers"`
+	}
+	if err := Unmarshal(buf.Bytes(), &result); err != nil {
+		t.Fatalf("can't parse the streamed document: %s\n%s", err, buf.String())
+	}
+	servers[2].Ports = []int{}
+	if result.Title != "servers" || !reflect.DeepEqual(result.Servers, servers) {
+		t.Errorf("expected %+v, got %+v from:\n%s", servers, result.Servers, buf.String())
+	}
+	if strings.Count(buf.String(), "[[servers]]") != 3 {
+		t.Errorf("expected a header per table, got:\n%s", buf.String())
+	}
+}
+
+func TestEncoderStreamArrayOfTablesDotted(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewEncoder(&buf)
+	write, closeStream := encoder.StreamArrayOfTables(`hosts."web.example"`)
+	for _, name := range []string{"alpha", "beta"} {
+		if err := write(streamedServer{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := closeStream(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := LoadBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("can't parse the streamed document: %s\n%s", err, buf.String())
+	}
+	servers, ok := tree.GetPath([]string{"hosts", "web.example"}).([]*Tree)
+	if !ok || len(servers) != 2 || servers[1].Get("name") != "beta" {
+		t.Errorf("expected a nested array of two tables, got:\n%s", buf.String())
+	}
+
+	write, _ = encoder.StreamArrayOfTables("hosts..web")
+	if err := write(streamedServer{}); err == nil {
+		t.Error("expected an error streaming an array with an invalid name")
+	}
+}
+
+func TestDecodeOnTable(t *testing.T) {
+	doc := []byte(`title = "shop"
+
+[store]
+name = "main"
+
+[[store.products]]
+name = "hammer"
+
+[[store.products]]
+name = "nail"
+
+["quoted.key".sub]
+`)
+	var events []string
+	onTable := func(path []string, pos Position) {
+		events = append(events, fmt.Sprintf("%s %s", strings.Join(path, "/"), pos))
+	}
+	var result map[string]interface{}
+	if err := NewDecoder(bytes.NewReader(doc)).OnTable(onTable).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"store (3, 1)",
+		"store/products (6, 1)",
+		"store/products (9, 1)",
+		"quoted.key/sub (12, 1)",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Bad table events: expected %v, got %v", expected, events)
+	}
+}
+
+func TestDecodeLenientLargeInteger(t *testing.T) {
+	var result struct {
+		Counter int64
+		Total   int64
+	}
+	doc := []byte("counter = \"9007199254740993\"\ntotal = \"9223372036854775807\"\n")
+	if err := NewDecoder(bytes.NewReader(doc)).Lenient(true).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Counter != 9007199254740993 {
+		t.Errorf("expected 9007199254740993, got %d", result.Counter)
+	}
+	if result.Total != math.MaxInt64 {
+		t.Errorf("expected %d, got %d", math.MaxInt64, result.Total)
+	}
+
+	doc = []byte("counter = \"9223372036854775808\"\n")
+	err := NewDecoder(bytes.NewReader(doc)).Lenient(true).Decode(&result)
+	if err == nil || err.Error() != "(1, 1): Can't convert 9223372036854775808(string) to int64" {
+		t.Errorf("expected an error for an int64 overflow, got %v", err)
+	}
+}
+
+func TestDecodeDisallowTabs(t *testing.T) {
+	var result struct {
+		Server struct {
+			Host  string
+			Ports []int
+		}
+	}
+	spaces := "[server]\n  host = \"localhost\"\n  ports = [\n    80,\n  ]\n"
+	if err := NewDecoder(strings.NewReader(spaces)).DisallowTabs(true).Decode(&result); err != nil {
+		t.Errorf("expected spaces to be accepted, got %v", err)
+	}
+
+	inline := "[server]\nhost =\t\"localhost\"\t# tabs after the start of the line\n"
+	if err := NewDecoder(strings.NewReader(inline)).DisallowTabs(true).Decode(&result); err != nil {
+		t.Errorf("expected tabs within a line to be accepted, got %v", err)
+	}
+
+	for doc, expected := range map[string]string{
+		"[server]\n\thost = \"localhost\"\n":   "(2, 1): parsing error: tabs are not allowed in indentation",
+		"[server]\n  \thost = \"localhost\"\n": "(2, 3): parsing error: tabs are not allowed in indentation",
+		"[server]\nports = [\n\t80,\n]\n":      "(3, 1): tabs are not allowed in indentation",
+		"\t[server]\n":                         "(1, 1): parsing error: tabs are not allowed in indentation",
+	} {
+		err := NewDecoder(strings.NewReader(doc)).DisallowTabs(true).Decode(&result)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", doc, expected, err)
+		}
+		if err := NewDecoder(strings.NewReader(doc)).Decode(&result); err != nil {
+			t.Errorf("%q: expected tabs to be accepted by default, got %v", doc, err)
+		}
+	}
+}
+
+func TestDecodeAllowDuplicateKeys(t *testing.T) {
+	doc := "port = 80\nport = 8080\n[server]\nhost = \"a\"\nhost = \"b\"\n"
+	var result map[string]interface{}
+	err := NewDecoder(strings.NewReader(doc)).Decode(&result)
+	if err == nil || err.Error() != "(2, 1): The following key was defined twice: port" {
+		t.Errorf("expected a duplicate key error, got %v", err)
+	}
+
+	if err := NewDecoder(strings.NewReader(doc)).AllowDuplicateKeys(true).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"port": int64(8080), "server": map[string]interface{}{"host": "b"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	err = NewDecoder(strings.NewReader("server.host = \"a\"\nserver = 1")).AllowDuplicateKeys(true).Decode(&result)
+	if err == nil || err.Error() != "(2, 1): The following key was defined twice: server" {
+		t.Errorf("expected a duplicate key error, got %v", err)
+	}
+}
+
+func TestDecodeNormalizeKeys(t *testing.T) {
+	// composes the only decomposed character of the test, as norm.NFC.String
+	// would
+	nfc := func(s string) string {
+		return strings.Replace(s, "e\u0301", "\u00e9", -1)
+	}
+	doc := "\"caf\u00e9\" = 1\n\"cafe\u0301\" = 2\n"
+
+	var result map[string]interface{}
+	if err := NewDecoder(strings.NewReader(doc)).Decode(&result); err != nil {
+		t.Errorf("expected keys to be kept as is by default, got %v", err)
+	}
+	if len(result) != 2 {
+		t.Errorf("expected two keys, got %v", result)
+	}
+
+	err := NewDecoder(strings.NewReader(doc)).NormalizeKeys(nfc).Decode(&result)
+	if err == nil || err.Error() != "(2, 1): The following key was defined twice: caf\u00e9" {
+		t.Errorf("expected a duplicate key error, got %v", err)
+	}
+
+	var tables struct {
+		Cafe map[string]int `toml:"caf\u00e9"`
+	}
+	doc = "[\"cafe\u0301\"]\n\"cre\u0301me\" = 1\n"
+	if err := NewDecoder(strings.NewReader(doc)).NormalizeKeys(nfc).Decode(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tables.Cafe, map[string]int{"cr\u00e9me": 1}) {
+		t.Errorf("expected normalized keys, got %v", tables.Cafe)
+	}
+}
+
+func TestDecodeDuplicateKeyPolicy(t *testing.T) {
+	doc := "port = 80\nport = 8080\npoint = { x = 1, x = 2 }\n"
+	for _, test := range []struct {
+		policy   DuplicateKeyPolicy
+		expected map[string]interface{}
+		err      string
+	}{
+		{DuplicateKeyError, nil, "(2, 1): The following key was defined twice: port"},
+		{DuplicateKeyFirstWins, map[string]interface{}{"port": int64(80), "point": map[string]interface{}{"x": int64(1)}}, ""},
+		{DuplicateKeyLastWins, map[string]interface{}{"port": int64(8080), "point": map[string]interface{}{"x": int64(2)}}, ""},
+	} {
+		var result map[string]interface{}
+		err := NewDecoder(strings.NewReader(doc)).SetDuplicateKeyPolicy(test.policy).Decode(&result)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("policy %d: expected error %q, got %v", test.policy, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("policy %d: %s", test.policy, err)
+		} else if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("policy %d: expected %v, got %v", test.policy, test.expected, result)
+		}
+	}
+
+	var result map[string]interface{}
+	err := NewDecoder(strings.NewReader("a.b = 1\na = 2")).SetDuplicateKeyPolicy(DuplicateKeyFirstWins).Decode(&result)
+	if err == nil || err.Error() != "(2, 1): The following key was defined twice: a" {
+		t.Errorf("expected a table to never be redefined, got %v", err)
+	}
+}
+
+func TestDecodeDisallowUnknownFields(t *testing.T) {
+	type server struct {
+		Host string
+		Port int
+	}
+	type config struct {
+		Title  string
+		Server server
+	}
+	doc := "title = \"strict\"\n[server]\nhost = \"localhost\"\nprot = 8080\n"
+
+	var result config
+	if err := NewDecoder(strings.NewReader(doc)).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Server.Host != "localhost" || result.Server.Port != 0 {
+		t.Errorf("bad result: %+v", result)
+	}
+
+	err := NewDecoder(strings.NewReader(doc)).DisallowUnknownFields().Decode(&result)
+	if err == nil || err.Error() != "(4, 1): unknown field server.prot" {
+		t.Errorf("expected an unknown field error, got %v", err)
+	}
+
+	var remain struct {
+		Title string
+		Other map[string]interface{} `toml:",remain"`
+	}
+	err = NewDecoder(strings.NewReader(doc)).DisallowUnknownFields().Decode(&remain)
+	if err != nil {
+		t.Errorf("expected the remain field to collect unknown keys, got %v", err)
+	}
+}
+
+func TestDecodeDisallowEmptyKeys(t *testing.T) {
+	for doc, expected := range map[string]string{
+		`"" = 1`:          "(1, 1): keys cannot be empty",
+		`'' = 1`:          "(1, 1): keys cannot be empty",
+		`a."" = 1`:        "(1, 1): keys cannot be empty",
+		"[a.'']\nb = 1":   "(1, 2): keys cannot be empty",
+		"[[\"\"]]\nb = 1": "(1, 3): keys cannot be empty",
+		`a = { "" = 1 }`:  "(1, 8): keys cannot be empty",
+	} {
+		var result map[string]interface{}
+		err := NewDecoder(strings.NewReader(doc)).DisallowEmptyKeys(true).Decode(&result)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", doc, expected, err)
+		}
+		if err := NewDecoder(strings.NewReader(doc)).Decode(&result); err != nil {
+			t.Errorf("%q: expected empty keys to be accepted by default, got %v", doc, err)
+		}
+	}
+
+	var result map[string]interface{}
+	err := NewDecoder(strings.NewReader("[]\na = 1")).Decode(&result)
+	if err == nil || err.Error() != "(1, 2): table headers cannot be empty" {
+		t.Errorf("expected an empty table header error, got %v", err)
+	}
+}
+
+func TestUnmarshalLocalDateTimes(t *testing.T) {
+	doc := []byte(`offset = 1979-05-27T07:32:00Z
+datetime = 1979-05-27T07:32:00.5
+date = 1979-05-27
+time = 07:32:00
+`)
+	var result struct {
+		Offset   time.Time
+		DateTime LocalDateTime
+		Date     LocalDate
+		Time     LocalTime
+	}
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	expectedDate := LocalDate{1979, time.May, 27}
+	expectedTime := LocalTime{7, 32, 0, 0}
+	expectedDateTime := LocalDateTime{expectedDate, LocalTime{7, 32, 0, 500000000}}
+	if !result.Offset.Equal(time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)) || result.DateTime != expectedDateTime ||
+		result.Date != expectedDate || result.Time != expectedTime {
+		t.Errorf("bad result: %+v", result)
+	}
+
+	var generic map[string]interface{}
+	if err := Unmarshal(doc, &generic); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := generic["offset"].(time.Time); !ok {
+		t.Errorf("expected a time.Time, got %T", generic["offset"])
+	}
+	if generic["datetime"] != expectedDateTime || generic["date"] != expectedDate || generic["time"] != expectedTime {
+		t.Errorf("bad result: %v", generic)
+	}
+
+	encoded, err := Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Date = 1979-05-27\nDateTime = 1979-05-27T07:32:00.5\nOffset = 1979-05-27T07:32:00Z\nTime = 07:32:00\n"
+	if string(encoded) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, encoded)
+	}
+}
+
+func TestUnmarshalArrays(t *testing.T) {
+	doc := []byte(`ports = [ # ports
+  8001, # first
+  8002,
+
+  8003, # last
+]
+nested = [[1, 2], [3, 4]]
+empty = []
+`)
+	var result struct {
+		Ports  []int
+		Nested [][]int
+		Empty  []string
+	}
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Ports, []int{8001, 8002, 8003}) || !reflect.DeepEqual(result.Nested, [][]int{{1, 2}, {3, 4}}) ||
+		result.Empty == nil || len(result.Empty) != 0 {
+		t.Errorf("bad result: %+v", result)
+	}
+
+	var generic map[string]interface{}
+	if err := Unmarshal(doc, &generic); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"ports":  []interface{}{int64(8001), int64(8002), int64(8003)},
+		"nested": []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{int64(3), int64(4)}},
+		"empty":  []interface{}{},
+	}
+	if !reflect.DeepEqual(generic, expected) {
+		t.Errorf("expected %#v, got %#v", expected, generic)
+	}
+}
+
+func TestUnmarshalInlineTables(t *testing.T) {
+	doc := []byte(`point = { x = 1, y = 2 }
+empty = {}
+server = { addr.host = "localhost", addr.port = 8080 }
+`)
+	var result struct {
+		Point struct {
+			X, Y int
+		}
+		Empty  map[string]interface{}
+		Server map[string]interface{}
+	}
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Point.X != 1 || result.Point.Y != 2 || result.Empty == nil || len(result.Empty) != 0 {
+		t.Errorf("bad result: %+v", result)
+	}
+	expected := map[string]interface{}{"addr": map[string]interface{}{"host": "localhost", "port": int64(8080)}}
+	if !reflect.DeepEqual(result.Server, expected) {
+		t.Errorf("expected %v, got %v", expected, result.Server)
+	}
+
+	err := Unmarshal([]byte("point = { x = 1,\ny = 2 }"), &result)
+	if err == nil || err.Error() != "(1, 17): newlines are not allowed in inline tables" {
+		t.Errorf("expected a newline error, got %v", err)
+	}
+}
+
+func TestUnmarshalTables(t *testing.T) {
+	doc := []byte(`title = "example"
+
+[server]
+host = "localhost"
+
+[server.alpha]
+ip = "10.0.0.1"
+
+[a."b.c"]
+answer = 42
+`)
+	var result struct {
+		Title  string
+		Server struct {
+			Host  string
+			Alpha struct {
+				IP string
+			}
+		}
+		A map[string]interface{}
+	}
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Title != "example" || result.Server.Host != "localhost" || result.Server.Alpha.IP != "10.0.0.1" {
+		t.Errorf("bad result: %+v", result)
+	}
+	expected := map[string]interface{}{"b.c": map[string]interface{}{"answer": int64(42)}}
+	if !reflect.DeepEqual(result.A, expected) {
+		t.Errorf("expected %v, got %v", expected, result.A)
+	}
+}
+
+func TestUnmarshalNestedArrayOfTables(t *testing.T) {
+	doc := []byte(`[[fruit]]
+name = "apple"
+
+[fruit.physical]
+color = "red"
+
+[[fruit.variety]]
+name = "red delicious"
+
+[[fruit.variety]]
+name = "granny smith"
+
+[[fruit]]
+name = "banana"
+
+[[fruit.variety]]
+name = "plantain"
+`)
+	type variety struct {
+		Name string
+	}
+	type fruit struct {
+		Name     string
+		Physical struct {
+			Color string
+		}
+		Variety []variety
+	}
+	var result struct {
+		Fruit []fruit
+	}
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	apple := fruit{Name: "apple", Variety: []variety{{"red delicious"}, {"granny smith"}}}
+	apple.Physical.Color = "red"
+	expected := []fruit{apple, {Name: "banana", Variety: []variety{{"plantain"}}}}
+	if !reflect.DeepEqual(result.Fruit, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result.Fruit)
+	}
+}
+
+func TestUnmarshalCaseInsensitiveFields(t *testing.T) {
+	var result struct {
+		Name    string
+		MaxSize int
+		Tagged  bool `toml:"isTagged"`
+	}
+	if err := Unmarshal([]byte("nAmE = \"x\"\nMAXSIZE = 3\nistagged = true"), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "x" || result.MaxSize != 3 || !result.Tagged {
+		t.Errorf("bad result: %+v", result)
+	}
+
+	err := Unmarshal([]byte("name = 1"), &result)
+	if err == nil || err.Error() != "(1, 1): Can't convert 1(int64) to string" {
+		t.Errorf("expected a conversion error, got %v", err)
+	}
+}
+
+func TestMarshalLiteralStrings(t *testing.T) {
+	type config struct {
+		Path    string
+		Pattern string
+		Quote   string
+	}
+	input := config{Path: `C:\Users\tom\new`, Pattern: `^\d+\.\d+$`, Quote: `it's "quoted"`}
+	encoded, err := Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Path = 'C:\Users\tom\new'
+Pattern = '^\d+\.\d+$'
+Quote = "it's \"quoted\""
+`
+	if string(encoded) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, encoded)
+	}
+
+	var decoded config
+	if err := Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != input {
+		t.Errorf("expected %+v, got %+v", input, decoded)
+	}
+}
+
+func TestUnmarshalFieldTags(t *testing.T) {
+	var result struct {
+		Addr    string `toml:"address,omitempty"`
+		Skipped string `toml:"-"`
+		Port    int
+		Name    string `toml:",omitempty"`
+	}
+	doc := []byte(`address = "localhost"
+addr = "unused"
+skipped = "unused"
+"-" = "unused"
+PORT = 8080
+name = "server"
+`)
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Addr != "localhost" || result.Skipped != "" || result.Port != 8080 || result.Name != "server" {
+		t.Errorf("bad result: %+v", result)
+	}
+}
+
+func TestUnmarshalPointerNestedStructs(t *testing.T) {
+	type limits struct {
+		Max int
+	}
+	type item struct {
+		Name string
+	}
+	type inner struct {
+		Host   string
+		Limits *limits
+	}
+	var result struct {
+		Inner   *inner
+		Missing *inner
+		Items   *[]item
+		Ptrs    []*item
+	}
+	doc := []byte(`[inner]
+host = "localhost"
+[inner.limits]
+max = 10
+[[items]]
+name = "a"
+[[items]]
+name = "b"
+[[ptrs]]
+name = "c"
+`)
+	if err := Unmarshal(doc, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Inner == nil || result.Inner.Host != "localhost" {
+		t.Fatalf("bad inner table: %+v", result.Inner)
+	}
+	if result.Inner.Limits == nil || result.Inner.Limits.Max != 10 {
+		t.Errorf("bad nested table: %+v", result.Inner.Limits)
+	}
+	if result.Missing != nil {
+		t.Errorf("expected a missing table to leave a nil pointer, got %+v", result.Missing)
+	}
+	if result.Items == nil || !reflect.DeepEqual(*result.Items, []item{{"a"}, {"b"}}) {
+		t.Errorf("bad array of tables: %+v", result.Items)
+	}
+	if len(result.Ptrs) != 1 || result.Ptrs[0].Name != "c" {
+		t.Errorf("bad array of table pointers: %+v", result.Ptrs)
+	}
+}
@@ -13,19 +13,46 @@ import (
 	"time"
 )
 
+// parserOptions relax the parser to accept documents that are not strictly
+// valid TOML
+type parserOptions struct {
+	// accept a comma after the last field of an inline table
+	allowInlineTableTrailingComma bool
+	// called with the path and position of each table header
+	onTable func(path []string, pos Position)
+	// accept booleans in any case, such as True or FALSE
+	caseInsensitiveBools bool
+	// associate the comments of the document to values and tables
+	keepComments bool
+	// parse integers as Integer values recording their radix
+	keepIntegerRadix bool
+	// reject tabs in indentation, which is checked while lexing
+	disallowTabs bool
+	// reject empty quoted keys, in assignments and table headers
+	disallowEmptyKeys bool
+	// what happens when a key is defined again
+	duplicateKeys DuplicateKeyPolicy
+	// applied to each key segment, if set
+	normalizeKey func(string) string
+}
+
 type tomlParser struct {
 	flowIdx       int
 	flow          []token
+	spans         []Span // source span of each token of flow, if known
 	tree          *Tree
 	currentTable  []string
 	seenTableKeys []string
+	options       parserOptions
+	// comments of the document by line, if kept
+	commentsByLine map[int]lexedComment
 }
 
 type tomlParserStateFn func() tomlParserStateFn
 
 // Formats and panics an error message based on a token
 func (p *tomlParser) raiseError(tok *token, msg string, args ...interface{}) {
-	panic(tok.Position.String() + ": " + fmt.Sprintf(msg, args...))
+	panic(&DecodeError{tok.Position, fmt.Sprintf(msg, args...)})
 }
 
 func (p *tomlParser) run() {
@@ -88,6 +115,9 @@ func (p *tomlParser) parseStart() tomlParserStateFn {
 func (p *tomlParser) parseGroupArray() tomlParserStateFn {
 	startToken := p.getToken() // discard the [[
 	key := p.getToken()
+	if key.typ == tokenDoubleRightBracket || key.typ == tokenKeyGroupArray && strings.TrimSpace(key.val) == "" {
+		p.raiseError(key, "table headers cannot be empty")
+	}
 	if key.typ != tokenKeyGroupArray {
 		p.raiseError(key, "unexpected token %s, was expecting a table array key", key)
 	}
@@ -97,7 +127,12 @@ func (p *tomlParser) parseGroupArray() tomlParserStateFn {
 	if err != nil {
 		p.raiseError(key, "invalid table array key: %s", err)
 	}
-	p.tree.createSubTree(keys[:len(keys)-1], startToken.Position) // create parent entries
+	p.checkEmptyKeys(key, keys)
+	p.normalizeKeys(keys)
+	// create parent entries
+	if err := p.tree.createSubTree(keys[:len(keys)-1], startToken.Position); err != nil {
+		p.raiseError(key, "%s", err)
+	}
 	destTree := p.tree.GetPath(keys)
 	var array []*Tree
 	if destTree == nil {
@@ -112,57 +147,159 @@ func (p *tomlParser) parseGroupArray() tomlParserStateFn {
 	// add a new tree to the end of the table array
 	newTree := newTree()
 	newTree.position = startToken.Position
+	newTree.comments = p.commentsOf(startToken.Line, startToken.Line)
 	array = append(array, newTree)
 	p.tree.SetPath(p.currentTable, array)
 
 	// remove all keys that were children of this table array
-	prefix := key.val + "."
+	canonicalKey := CanonicalKey(keys)
+	prefix := canonicalKey + "."
 	found := false
 	for ii := 0; ii < len(p.seenTableKeys); {
 		tableKey := p.seenTableKeys[ii]
 		if strings.HasPrefix(tableKey, prefix) {
 			p.seenTableKeys = append(p.seenTableKeys[:ii], p.seenTableKeys[ii+1:]...)
 		} else {
-			found = (tableKey == key.val)
+			found = (tableKey == canonicalKey)
 			ii++
 		}
 	}
 
 	// keep this key name from use by other kinds of assignments
 	if !found {
-		p.seenTableKeys = append(p.seenTableKeys, key.val)
+		p.seenTableKeys = append(p.seenTableKeys, canonicalKey)
 	}
 
 	// move to next parser state
 	p.assume(tokenDoubleRightBracket)
+	p.tableStarted(keys, startToken.Position)
 	return p.parseStart
 }
 
 func (p *tomlParser) parseGroup() tomlParserStateFn {
 	startToken := p.getToken() // discard the [
 	key := p.getToken()
+	if key.typ == tokenRightBracket || key.typ == tokenKeyGroup && strings.TrimSpace(key.val) == "" {
+		p.raiseError(key, "table headers cannot be empty")
+	}
 	if key.typ != tokenKeyGroup {
 		p.raiseError(key, "unexpected token %s, was expecting a table key", key)
 	}
+	keys, err := parseKey(key.val)
+	if err != nil {
+		p.raiseError(key, "invalid table key: %s", err)
+	}
+	p.checkEmptyKeys(key, keys)
+	p.normalizeKeys(keys)
+	// keys are compared in their canonical form, as the same table can be
+	// written with different spacing and quoting
+	canonicalKey := CanonicalKey(keys)
 	for _, item := range p.seenTableKeys {
-		if item == key.val {
+		if item == canonicalKey {
 			p.raiseError(key, "duplicated tables")
 		}
 	}
-
-	p.seenTableKeys = append(p.seenTableKeys, key.val)
-	keys, err := parseKey(key.val)
-	if err != nil {
-		p.raiseError(key, "invalid table array key: %s", err)
-	}
+	p.seenTableKeys = append(p.seenTableKeys, canonicalKey)
 	if err := p.tree.createSubTree(keys, startToken.Position); err != nil {
 		p.raiseError(key, "%s", err)
 	}
 	p.assume(tokenRightBracket)
 	p.currentTable = keys
+	if tree, ok := p.tree.GetPath(keys).(*Tree); ok {
+		tree.comments = p.commentsOf(startToken.Line, startToken.Line)
+	}
+	p.tableStarted(keys, startToken.Position)
 	return p.parseStart
 }
 
+// reports whether the key at path, whose current value is existing, must be
+// assigned, or keep its value. Raises an error if the key is already defined
+// and the duplicate key policy does not allow it, or it is a table.
+func (p *tomlParser) mustAssign(key *token, path []string, existing interface{}) bool {
+	switch existing.(type) {
+	case nil:
+		return true
+	case *Tree, []*Tree:
+	default:
+		switch p.options.duplicateKeys {
+		case DuplicateKeyLastWins:
+			return true
+		case DuplicateKeyFirstWins:
+			return false
+		}
+	}
+	p.raiseError(key, "The following key was defined twice: %s", strings.Join(path, "."))
+	return false
+}
+
+// raises an error if a prefix of path, the dotted key to assign in tree, is
+// already defined as a value: dotted keys can only extend tables
+func (p *tomlParser) checkDottedKey(key *token, tree *Tree, path []string) {
+	for i := 1; i < len(path); i++ {
+		switch tree.GetPath(path[:i]).(type) {
+		case *Tree, []*Tree, nil:
+		default:
+			p.raiseError(key, "key %s is already defined as a value, cannot define %s",
+				strings.Join(path[:i], "."), strings.Join(path, "."))
+		}
+	}
+}
+
+// raises an error if one of the keys is empty and empty keys are disallowed
+func (p *tomlParser) checkEmptyKeys(tok *token, keys []string) {
+	if !p.options.disallowEmptyKeys {
+		return
+	}
+	for _, k := range keys {
+		if k == "" {
+			p.raiseError(tok, "keys cannot be empty")
+		}
+	}
+}
+
+// normalizes the keys in place, if a normalization is set
+func (p *tomlParser) normalizeKeys(keys []string) {
+	if p.options.normalizeKey == nil {
+		return
+	}
+	for i, k := range keys {
+		keys[i] = p.options.normalizeKey(k)
+	}
+}
+
+// returns the comments associated with an element spanning from firstLine to
+// lastLine: the block of comment lines directly above it, and the comment
+// following it on its last line. Returns nil if comments are not kept or there
+// are none.
+func (p *tomlParser) commentsOf(firstLine, lastLine int) *keyComments {
+	if !p.options.keepComments {
+		return nil
+	}
+	var leading []string
+	for line := firstLine - 1; ; line-- {
+		c, ok := p.commentsByLine[line]
+		if !ok || c.trailing {
+			break
+		}
+		leading = append([]string{c.text}, leading...)
+	}
+	var trailing string
+	if c, ok := p.commentsByLine[lastLine]; ok && c.trailing {
+		trailing = c.text
+	}
+	if len(leading) == 0 && trailing == "" {
+		return nil
+	}
+	return &keyComments{leading: leading, trailing: trailing}
+}
+
+// notify the onTable callback, if any, of a table header
+func (p *tomlParser) tableStarted(keys []string, pos Position) {
+	if p.options.onTable != nil {
+		p.options.onTable(append([]string(nil), keys...), pos)
+	}
+}
+
 func (p *tomlParser) parseAssign() tomlParserStateFn {
 	key := p.getToken()
 	p.assume(tokenEqual)
@@ -171,8 +308,12 @@ func (p *tomlParser) parseAssign() tomlParserStateFn {
 	if err != nil {
 		p.raiseError(key, "invalid key: %s", err.Error())
 	}
+	p.checkEmptyKeys(key, parsedKey)
+	p.normalizeKeys(parsedKey)
 
+	valueIdx := p.flowIdx
 	value := p.parseRvalue()
+	span := p.spanOf(valueIdx, p.flowIdx)
 	var tableKey []string
 	if len(p.currentTable) > 0 {
 		tableKey = p.currentTable
@@ -183,6 +324,8 @@ func (p *tomlParser) parseAssign() tomlParserStateFn {
 	prefixKey := parsedKey[0 : len(parsedKey)-1]
 	tableKey = append(tableKey, prefixKey...)
 
+	p.checkDottedKey(key, p.tree, append(tableKey, parsedKey[len(parsedKey)-1]))
+
 	// find the table to assign, looking out for arrays of tables
 	var targetNode *Tree
 	switch node := p.tree.GetPath(tableKey).(type) {
@@ -205,17 +348,21 @@ func (p *tomlParser) parseAssign() tomlParserStateFn {
 	keyVal := parsedKey[len(parsedKey)-1]
 	localKey := []string{keyVal}
 	finalKey := append(tableKey, keyVal)
-	if targetNode.GetPath(localKey) != nil {
-		p.raiseError(key, "The following key was defined twice: %s",
-			strings.Join(finalKey, "."))
+	if !p.mustAssign(key, finalKey, targetNode.GetPath(localKey)) {
+		return p.parseStart
 	}
 	var toInsert interface{}
 
-	switch value.(type) {
-	case *Tree, []*Tree:
+	comments := p.commentsOf(key.Line, p.flow[p.flowIdx-1].Line)
+	switch v := value.(type) {
+	case *Tree:
+		v.span = span
+		v.comments = comments
+		toInsert = value
+	case []*Tree:
 		toInsert = value
 	default:
-		toInsert = &tomlValue{value: value, position: key.Position}
+		toInsert = &tomlValue{value: value, position: key.Position, span: span, comments: comments}
 	}
 	targetNode.values[keyVal] = toInsert
 	return p.parseStart
@@ -253,8 +400,10 @@ func (p *tomlParser) parseRvalue() interface{} {
 	case tokenString:
 		return tok.val
 	case tokenTrue:
+		p.checkBoolCase(tok, "true")
 		return true
 	case tokenFalse:
+		p.checkBoolCase(tok, "false")
 		return false
 	case tokenInf:
 		if tok.val[0] == '-' {
@@ -288,18 +437,25 @@ func (p *tomlParser) parseRvalue() interface{} {
 				}
 				val, err = strconv.ParseInt(cleanedVal[2:], 2, 64)
 			default:
-				panic("invalid base") // the lexer should catch this first
+				// the lexer catches unknown bases, leaving decimal digits
+				p.raiseError(tok, "leading zeros are not allowed in integers")
 			}
 		} else {
 			err = numberContainsInvalidUnderscore(tok.val)
 			if err != nil {
 				p.raiseError(tok, "%s", err)
 			}
+			if digits := strings.TrimLeft(cleanedVal, "+-"); len(digits) > 1 && digits[0] == '0' {
+				p.raiseError(tok, "leading zeros are not allowed in integers")
+			}
 			val, err = strconv.ParseInt(cleanedVal, 10, 64)
 		}
 		if err != nil {
 			p.raiseError(tok, "%s", err)
 		}
+		if p.options.keepIntegerRadix {
+			return Integer{Value: val, Radix: integerRadix(tok.val)}
+		}
 		return val
 	case tokenFloat:
 		err := numberContainsInvalidUnderscore(tok.val)
@@ -313,7 +469,26 @@ func (p *tomlParser) parseRvalue() interface{} {
 		}
 		return val
 	case tokenDate:
-		val, err := time.ParseInLocation(time.RFC3339Nano, tok.val, time.UTC)
+		// fractional seconds beyond nanoseconds are truncated
+		val, err := time.ParseInLocation(time.RFC3339Nano, normalizeDateTime(tok.val), time.UTC)
+		if err != nil {
+			p.raiseError(tok, "%s", err)
+		}
+		return val
+	case tokenLocalDate:
+		val, err := ParseLocalDate(tok.val)
+		if err != nil {
+			p.raiseError(tok, "%s", err)
+		}
+		return val
+	case tokenLocalTime:
+		val, err := ParseLocalTime(tok.val)
+		if err != nil {
+			p.raiseError(tok, "%s", err)
+		}
+		return val
+	case tokenLocalDateTime:
+		val, err := ParseLocalDateTime(tok.val)
 		if err != nil {
 			p.raiseError(tok, "%s", err)
 		}
@@ -333,6 +508,13 @@ func (p *tomlParser) parseRvalue() interface{} {
 	return nil
 }
 
+// booleans are lexed regardless of case, but TOML only allows lowercase
+func (p *tomlParser) checkBoolCase(tok *token, expected string) {
+	if tok.val != expected && !p.options.caseInsensitiveBools {
+		p.raiseError(tok, "boolean must be lowercase %s, got %s", expected, tok.val)
+	}
+}
+
 func tokenIsComma(t *token) bool {
 	return t != nil && t.typ == tokenComma
 }
@@ -356,8 +538,32 @@ Loop:
 			}
 			key := p.getToken()
 			p.assume(tokenEqual)
+
+			// quoted keys are lexed as strings, and are never dotted
+			parsedKey := []string{key.val}
+			if key.typ != tokenString {
+				var err error
+				parsedKey, err = parseKey(key.val)
+				if err != nil {
+					p.raiseError(key, "invalid key: %s", err)
+				}
+			}
+			p.checkEmptyKeys(key, parsedKey)
+			p.normalizeKeys(parsedKey)
+			valueIdx := p.flowIdx
 			value := p.parseRvalue()
-			tree.Set(key.val, value)
+			span := p.spanOf(valueIdx, p.flowIdx)
+			p.checkDottedKey(key, tree, parsedKey)
+			if p.mustAssign(key, parsedKey, tree.GetPath(parsedKey)) {
+				switch v := value.(type) {
+				case *Tree:
+					v.span = span
+				case []*Tree:
+				default:
+					value = &tomlValue{value: value, position: key.Position, span: span}
+				}
+				tree.SetPath(parsedKey, value)
+			}
 		case tokenComma:
 			if previous == nil {
 				p.raiseError(follow, "inline table cannot start with a comma")
@@ -366,12 +572,14 @@ Loop:
 				p.raiseError(follow, "need field between two commas in inline table")
 			}
 			p.getToken()
+		case tokenError:
+			p.raiseError(follow, "%s", follow)
 		default:
 			p.raiseError(follow, "unexpected token type in inline table: %s", follow.String())
 		}
 		previous = follow
 	}
-	if tokenIsComma(previous) {
+	if tokenIsComma(previous) && !p.options.allowInlineTableTrailingComma {
 		p.raiseError(previous, "trailing comma at the end of inline table")
 	}
 	return tree
@@ -389,12 +597,16 @@ func (p *tomlParser) parseArray() interface{} {
 			p.getToken()
 			break
 		}
+		if follow.typ == tokenComma {
+			p.raiseError(follow, "expected a value before comma in array")
+		}
 		val := p.parseRvalue()
-		if arrayType == nil {
+		if len(array) == 0 {
 			arrayType = reflect.TypeOf(val)
-		}
-		if reflect.TypeOf(val) != arrayType {
-			p.raiseError(follow, "mixed types in array")
+		} else if reflect.TypeOf(val) != arrayType {
+			// arrays may mix types, in which case inline tables are kept as
+			// *Tree values of an []interface{}
+			arrayType = nil
 		}
 		array = append(array, val)
 		follow = p.peek()
@@ -422,15 +634,32 @@ func (p *tomlParser) parseArray() interface{} {
 	return array
 }
 
-func parseToml(flow []token) *Tree {
+// returns the source span covering the tokens of the flow from index start
+// up to, but excluding, index end
+func (p *tomlParser) spanOf(start, end int) Span {
+	if len(p.spans) < end || start >= end {
+		return Span{}
+	}
+	return Span{Start: p.spans[start].Start, End: p.spans[end-1].End}
+}
+
+func parseToml(flow []token, spans []Span, comments []lexedComment, options parserOptions) *Tree {
 	result := newTree()
 	result.position = Position{1, 1}
 	parser := &tomlParser{
 		flowIdx:       0,
 		flow:          flow,
+		spans:         spans,
 		tree:          result,
 		currentTable:  make([]string, 0),
 		seenTableKeys: make([]string, 0),
+		options:       options,
+	}
+	if options.keepComments {
+		parser.commentsByLine = make(map[int]lexedComment, len(comments))
+		for _, c := range comments {
+			parser.commentsByLine[c.Line] = c
+		}
 	}
 	parser.run()
 	return result
@@ -79,7 +79,7 @@ zyx = 42`)
 	if err == nil {
 		t.Error("Error should have been returned.")
 	}
-	if err.Error() != "(1, 4): parsing error: keys cannot contain ] character" {
+	if err.Error() != "(1, 4): parsing error: a table header must be followed by a newline" {
 		t.Error("Bad error message:", err.Error())
 	}
 }
@@ -113,6 +113,37 @@ minusnan = -nan
 	})
 }
 
+func TestSpecialFloatsErrors(t *testing.T) {
+	for value, expected := range map[string]string{
+		"Inf":   "(1, 5): inf and nan must be lowercase, got Inf",
+		"-INF":  "(1, 5): inf and nan must be lowercase, got INF",
+		"NaN":   "(1, 5): inf and nan must be lowercase, got NaN",
+		"infx":  "(1, 5): invalid float infx",
+		"+nan1": "(1, 5): invalid float +nan1",
+	} {
+		_, err := Load("a = " + value)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", value, expected, err)
+		}
+	}
+
+	tree, err := Load("inf = 1\nnan = 2\na = [inf, -nan]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Get("inf") != int64(1) || tree.Get("nan") != int64(2) {
+		t.Errorf("expected inf and nan to be accepted as keys, got %v", tree)
+	}
+
+	tree, err = Load("a = { Inf = 1, NaN = 2 }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Get("a.Inf") != int64(1) || tree.Get("a.NaN") != int64(2) {
+		t.Errorf("expected Inf and NaN to be accepted as inline table keys, got %v", tree)
+	}
+}
+
 func TestHexIntegers(t *testing.T) {
 	tree, err := Load(`a = 0xDEADBEEF`)
 	assertTree(t, tree, err, map[string]interface{}{"a": int64(3735928559)})
@@ -193,6 +224,124 @@ func TestNumbersWithUnderscores(t *testing.T) {
 	})
 }
 
+func TestBooleansMustBeLowercase(t *testing.T) {
+	for doc, expected := range map[string]string{
+		"a = True":         "(1, 5): boolean must be lowercase true, got True",
+		"a = FALSE":        "(1, 5): boolean must be lowercase false, got FALSE",
+		"a = [true, tRUE]": "(1, 12): boolean must be lowercase true, got tRUE",
+	} {
+		_, err := Load(doc)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", doc, expected, err)
+		}
+	}
+
+	tree, err := Load("a = { True = 1, FALSE = 2 }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Get("a.True") != int64(1) || tree.Get("a.FALSE") != int64(2) {
+		t.Errorf("expected True and FALSE to be accepted as inline table keys, got %v", tree)
+	}
+}
+
+func TestBooleansMustBeTerminated(t *testing.T) {
+	for doc, expected := range map[string]string{
+		"a = truex":           "(1, 5): invalid boolean truex",
+		"a = false_":          "(1, 5): invalid boolean false_",
+		"a = [true1, false]":  "(1, 6): invalid boolean true1",
+		"a = { b = trueish }": "(1, 11): invalid boolean trueish",
+	} {
+		_, err := Load(doc)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", doc, expected, err)
+		}
+	}
+
+	tree, err := Load("a = true#comment\nb = [true,false]\nc = {d = false}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Get("a") != true || tree.Get("c.d") != false {
+		t.Errorf("bad tree: %v", tree)
+	}
+}
+
+func TestFloatsWithInvalidUnderscores(t *testing.T) {
+	for _, value := range []string{
+		"1_.0",
+		"1._0",
+		"1.0_",
+		"1.0_e5",
+		"1.0e_5",
+		"1.0E_5",
+		"1.0e+_5",
+		"1.0e5_",
+		"+_1.0",
+		"-_1.0",
+		"1__0.0",
+	} {
+		_, err := Load("a = " + value)
+		if err == nil || err.Error() != "(1, 5): invalid use of _ in number" {
+			t.Errorf("%s: expected invalid underscore error, got %v", value, err)
+		}
+	}
+
+	tree, err := Load("a = 1_0.0_1e1_0")
+	assertTree(t, tree, err, map[string]interface{}{
+		"a": float64(10.01e10),
+	})
+}
+
+func TestPrefixedIntegersErrors(t *testing.T) {
+	for value, expected := range map[string]string{
+		"+0xFF": "(1, 5): hexadecimal, octal and binary integers cannot have a sign",
+		"-0o7":  "(1, 5): hexadecimal, octal and binary integers cannot have a sign",
+		"-0b1":  "(1, 5): hexadecimal, octal and binary integers cannot have a sign",
+		"0x":    "(1, 5): number needs at least one digit",
+		"0o8":   "(1, 5): number needs at least one digit",
+		"0b12":  "(1, 5): invalid number 0b12",
+	} {
+		_, err := Load("a = " + value)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", value, expected, err)
+		}
+	}
+}
+
+func TestIntegersWithInvalidUnderscores(t *testing.T) {
+	for value, expected := range map[string]string{
+		"_1":           "(1, 5): cannot start number with underscore",
+		"1_":           "(1, 5): invalid use of _ in number",
+		"1__0":         "(1, 5): invalid use of _ in number",
+		"-_1":          "(1, 5): invalid use of _ in number",
+		"0xdead__beef": "(1, 5): invalid use of _ in hex number",
+		"0xdead_":      "(1, 5): invalid use of _ in hex number",
+	} {
+		_, err := Load("a = " + value)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", value, expected, err)
+		}
+	}
+}
+
+func TestFloatsWithMissingDigits(t *testing.T) {
+	for value, expected := range map[string]string{
+		".5":   "(1, 5): cannot start float with a dot",
+		"-.5":  "(1, 5): cannot start float with a dot",
+		"5.":   "(1, 5): float cannot end with a dot",
+		"5.e3": "(1, 5): float cannot end with a dot",
+		"1e":   "(1, 5): float exponent needs at least one digit",
+		"1.5E": "(1, 5): float exponent needs at least one digit",
+		"1e+":  "(1, 5): float exponent needs at least one digit",
+	} {
+		_, err := Load("a = " + value)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", value, expected, err)
+		}
+	}
+}
+
 func TestFloatsWithExponents(t *testing.T) {
 	tree, err := Load("a = 5e+22\nb = 5E+22\nc = -5e+22\nd = -5e-22\ne = 6.626e-34")
 	assertTree(t, tree, err, map[string]interface{}{
@@ -225,6 +374,28 @@ func TestDateNano(t *testing.T) {
 	})
 }
 
+func TestDateSeparatorCase(t *testing.T) {
+	for _, input := range []string{"a = 1979-05-27T07:32:00Z", "a = 1979-05-27t07:32:00z", "a = 1979-05-27 07:32:00z"} {
+		tree, err := Load(input)
+		assertTree(t, tree, err, map[string]interface{}{
+			"a": time.Date(1979, time.May, 27, 7, 32, 0, 0, time.UTC),
+		})
+	}
+
+	tree, err := Load("a = 1979-05-27t07:32:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := LocalDateTimeOf(time.Date(1979, time.May, 27, 7, 32, 0, 0, time.UTC)); tree.Get("a") != expected {
+		t.Errorf("expected %v, got %v", expected, tree.Get("a"))
+	}
+
+	_, err = Load("a = 1979-05-27X07:32:00Z")
+	if err == nil || err.Error() != "(1, 5): invalid date-time 1979-05-27X07:32:00Z" {
+		t.Errorf("expected an invalid date-time error, got %v", err)
+	}
+}
+
 func TestSimpleString(t *testing.T) {
 	tree, err := Load("a = \"hello world\"")
 	assertTree(t, tree, err, map[string]interface{}{
@@ -416,15 +587,42 @@ func TestNestedEmptyArrays(t *testing.T) {
 }
 
 func TestArrayMixedTypes(t *testing.T) {
-	_, err := Load("a = [42, 16.0]")
-	if err.Error() != "(1, 10): mixed types in array" {
-		t.Error("Bad error message:", err.Error())
-	}
+	tree, err := Load("a = [42, 16.0]\nb = [42, \"hello\", [true]]")
+	assertTree(t, tree, err, map[string]interface{}{
+		"a": []interface{}{int64(42), 16.0},
+		"b": []interface{}{int64(42), "hello", []interface{}{true}},
+	})
 
-	_, err = Load("a = [42, \"hello\"]")
-	if err.Error() != "(1, 11): mixed types in array" {
-		t.Error("Bad error message:", err.Error())
+	tree, err = Load("c = [{ d = 1 }, 2, { e = [3, { f = 4 }] }]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"c": []interface{}{
+			map[string]interface{}{"d": int64(1)},
+			int64(2),
+			map[string]interface{}{"e": []interface{}{int64(3), map[string]interface{}{"f": int64(4)}}},
+		},
 	}
+	if !reflect.DeepEqual(tree.ToMap(), expected) {
+		t.Errorf("expected %v, got %v", expected, tree.ToMap())
+	}
+	if tree.String() != "c = [{ d = 1 },2,{ e = [3,{ f = 4 }] }]\n" {
+		t.Errorf("bad string representation: %q", tree.String())
+	}
+}
+
+// the toml-test documents of arrays mixing types, which toml-test considered
+// invalid before TOML 1.0
+func TestArrayMixedTypesTomlTest(t *testing.T) {
+	tree, err := Load(`arrays-and-ints =  [1, ["Arrays are not integers."]]
+ints-and-floats = [1, 1.1]
+strings-and-ints = ["hi", 42]`)
+	assertTree(t, tree, err, map[string]interface{}{
+		"arrays-and-ints":  []interface{}{int64(1), []interface{}{"Arrays are not integers."}},
+		"ints-and-floats":  []interface{}{int64(1), 1.1},
+		"strings-and-ints": []interface{}{"hi", int64(42)},
+	})
 }
 
 func TestArrayNestedStrings(t *testing.T) {
@@ -453,6 +651,25 @@ func TestMissingValue(t *testing.T) {
 	}
 }
 
+func TestUnterminatedMultilineString(t *testing.T) {
+	_, err := Load("a = 1\nb = \"\"\"\nfoo\nbar")
+	if err.Error() != "(2, 5): unclosed multiline string starting at (2, 5)" {
+		t.Error("Bad error message:", err.Error())
+	}
+
+	_, err = Load("a = 1\n  b = '''foo\n\nbar")
+	if err.Error() != "(2, 7): unclosed multiline string starting at (2, 7)" {
+		t.Error("Bad error message:", err.Error())
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	_, err := LoadBytes([]byte("[table]\nkey = \"caf\xe9\""))
+	if err == nil || err.Error() != "(2, 11): parsing error: invalid UTF-8 byte 0xe9" {
+		t.Error("Bad error message:", err)
+	}
+}
+
 func TestUnterminatedArray(t *testing.T) {
 	_, err := Load("a = [1,")
 	if err.Error() != "(1, 8): unterminated array" {
@@ -491,6 +708,20 @@ func TestArrayWithExtraCommaComment(t *testing.T) {
 	})
 }
 
+func TestArrayWithMissingValues(t *testing.T) {
+	for input, expected := range map[string]string{
+		"a = [1,,2]": "(1, 8): expected a value before comma in array",
+		"a = [,]":    "(1, 6): expected a value before comma in array",
+		"a = [1 2]":  "(1, 8): missing comma",
+		"a = [1,2":   "(1, 9): unterminated array",
+	} {
+		_, err := Load(input)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
 func TestSimpleInlineGroup(t *testing.T) {
 	tree, err := Load("key = {a = 42}")
 	assertTree(t, tree, err, map[string]interface{}{
@@ -537,6 +768,28 @@ func TestExampleInlineGroupInArray(t *testing.T) {
 	})
 }
 
+func TestInlineGroupDottedKeys(t *testing.T) {
+	tree, err := Load(`a = { b.c = 1, b.d = 2, "e.f" = 3 }`)
+	assertTree(t, tree, err, map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": map[string]interface{}{
+				"c": int64(1),
+				"d": int64(2),
+			},
+		},
+	})
+	if tree.GetPath([]string{"a", "e.f"}) != int64(3) {
+		t.Errorf("quoted key should not be split, got %v", tree.Get("a"))
+	}
+}
+
+func TestInlineTableDuplicateKey(t *testing.T) {
+	_, err := Load("foo = {a.b = 1, a.b = 2}")
+	if err.Error() != "(1, 17): The following key was defined twice: a.b" {
+		t.Error("Bad error message:", err.Error())
+	}
+}
+
 func TestInlineTableUnterminated(t *testing.T) {
 	_, err := Load("foo = {")
 	if err.Error() != "(1, 8): unterminated inline table" {
@@ -565,6 +818,69 @@ func TestInlineTableDoubleComma(t *testing.T) {
 	}
 }
 
+func TestInlineTableTrailingComma(t *testing.T) {
+	_, err := Load("foo = {hello = 53, bar = 17,}")
+	if err.Error() != "(1, 28): trailing comma at the end of inline table" {
+		t.Error("Bad error message:", err.Error())
+	}
+
+	tree, err := loadBytes([]byte("foo = {hello = 53, bar = 17,}"),
+		parserOptions{allowInlineTableTrailingComma: true})
+	assertTree(t, tree, err, map[string]interface{}{
+		"foo": map[string]interface{}{
+			"hello": int64(53),
+			"bar":   int64(17),
+		},
+	})
+
+	_, err = loadBytes([]byte("foo = {,}"), parserOptions{allowInlineTableTrailingComma: true})
+	if err.Error() != "(1, 8): inline table cannot start with a comma" {
+		t.Error("Bad error message:", err.Error())
+	}
+}
+
+func TestInlineTableEmpty(t *testing.T) {
+	tree, err := Load("foo = {}\nbar = { }")
+	assertTree(t, tree, err, map[string]interface{}{
+		"foo": map[string]interface{}{},
+		"bar": map[string]interface{}{},
+	})
+}
+
+func TestInlineTableNewlines(t *testing.T) {
+	for input, expected := range map[string]string{
+		"foo = {\n}":                "(1, 8): newlines are not allowed in inline tables",
+		"foo = {a = 1,\nb = 2}":     "(1, 14): newlines are not allowed in inline tables",
+		"foo = {a = 1 # comment\n}": "(1, 23): newlines are not allowed in inline tables",
+	} {
+		_, err := Load(input)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", input, expected, err)
+		}
+	}
+
+	// newlines are allowed within values
+	tree, err := Load("foo = {a = [1,\n2], b = \"\"\"x\ny\"\"\"}")
+	assertTree(t, tree, err, map[string]interface{}{
+		"foo": map[string]interface{}{
+			"a": []int64{1, 2},
+			"b": "x\ny",
+		},
+	})
+}
+
+func TestBackslashFollowedByWhitespace(t *testing.T) {
+	for input, expected := range map[string]string{
+		"foo = \"a\\ b\"":         "(1, 8): invalid escape sequence: \\ ",
+		"foo = \"\"\"a\\ b\"\"\"": "(1, 10): only whitespace can follow a line ending backslash",
+	} {
+		_, err := Load(input)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
 func TestDuplicateGroups(t *testing.T) {
 	_, err := Load("[foo]\na=2\n[foo]b=3")
 	if err.Error() != "(3, 2): duplicated tables" {
@@ -579,9 +895,50 @@ func TestDuplicateKeys(t *testing.T) {
 	}
 }
 
+func TestKeysRedefinedAsTables(t *testing.T) {
+	for input, expected := range map[string]string{
+		"foo = 1\n[foo]":                 "(2, 2): key foo is already defined as a value, cannot define table foo",
+		"[foo]\nbar = 1\n[foo.bar]":      "(3, 2): key foo.bar is already defined as a value, cannot define table foo.bar",
+		"foo = 1\n[[foo.bar]]":           "(2, 3): key foo is already defined as a value, cannot define table foo",
+		"[foo]\nbar = 1\n[foo]\nbar = 2": "(3, 2): duplicated tables",
+	} {
+		_, err := Load(input)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestDuplicateGroupsWithDifferentSpelling(t *testing.T) {
+	for _, input := range []string{
+		"[foo]\na = 1\n[ foo ]\nb = 2",
+		"[foo]\na = 1\n[\"foo\"]\nb = 2",
+		"[foo.bar]\na = 1\n[foo . 'bar']\nb = 2",
+	} {
+		_, err := Load(input)
+		if err == nil || err.Error() != "(3, 2): duplicated tables" {
+			t.Errorf("%q: expected a duplicated tables error, got %v", input, err)
+		}
+	}
+}
+
+func TestEmptyTableHeaders(t *testing.T) {
+	for input, expected := range map[string]string{
+		"[]":    "(1, 2): table headers cannot be empty",
+		"[ ]":   "(1, 2): table headers cannot be empty",
+		"[[]]":  "(1, 3): table headers cannot be empty",
+		"[[ ]]": "(1, 3): table headers cannot be empty",
+	} {
+		_, err := Load(input)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", input, expected, err)
+		}
+	}
+}
+
 func TestEmptyIntermediateTable(t *testing.T) {
 	_, err := Load("[foo..bar]")
-	if err.Error() != "(1, 2): invalid table array key: expecting key part after dot" {
+	if err.Error() != "(1, 2): invalid table key: expecting key part after dot" {
 		t.Error("Bad error message:", err.Error())
 	}
 }
@@ -693,7 +1050,7 @@ func TestParseFileCRLF(t *testing.T) {
 }
 
 func TestParseKeyGroupArray(t *testing.T) {
-	tree, err := Load("[[foo.bar]] a = 42\n[[foo.bar]] a = 69")
+	tree, err := Load("[[foo.bar]]\na = 42\n[[foo.bar]]\na = 69")
 	assertTree(t, tree, err, map[string]interface{}{
 		"foo": map[string]interface{}{
 			"bar": []map[string]interface{}{
@@ -766,7 +1123,7 @@ func TestTomlValueStringRepresentation(t *testing.T) {
 			"[\"gamma\",\"delta\"]"},
 		{nil, ""},
 	} {
-		result, err := tomlValueStringRepresentation(item.Value, "", false)
+		result, err := tomlValueStringRepresentation(item.Value, "", 0)
 		if err != nil {
 			t.Errorf("Test %d - unexpected error: %s", idx, err)
 		}
@@ -898,6 +1255,42 @@ func TestInvalidFloatParsing(t *testing.T) {
 	}
 }
 
+func TestIntegersWithLeadingZeros(t *testing.T) {
+	for _, value := range []string{"007", "+01", "-0_1", "00"} {
+		_, err := Load("a = " + value)
+		if err == nil || err.Error() != "(1, 5): leading zeros are not allowed in integers" {
+			t.Errorf("%s: expected a leading zeros error, got %v", value, err)
+		}
+	}
+
+	tree, err := Load("a = 0\nb = +0\nc = -0\nd = 10\ne = [0, 100]\nf = { g = 0 }")
+	assertTree(t, tree, err, map[string]interface{}{
+		"a": int64(0),
+		"b": int64(0),
+		"c": int64(0),
+		"d": int64(10),
+		"e": []int64{0, 100},
+		"f": map[string]interface{}{
+			"g": int64(0),
+		},
+	})
+}
+
+func TestNumbersMustBeTerminated(t *testing.T) {
+	for doc, expected := range map[string]string{
+		"a = 80a":        "(1, 5): invalid number 80a",
+		"a = [1, 2x]":    "(1, 9): invalid number 2x",
+		"a = 1.5.":       "(1, 5): cannot have two dots in one float",
+		"a = 0x1G":       "(1, 5): invalid number 0x1G",
+		"a = { b = 1c }": "(1, 11): invalid number 1c",
+	} {
+		_, err := Load(doc)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %q, got %v", doc, expected, err)
+		}
+	}
+}
+
 func TestMapKeyIsNum(t *testing.T) {
 	_, err := Load("table={2018=1,2019=2}")
 	if err != nil {
@@ -937,3 +1330,56 @@ func TestInvalidDottedKeyEmptyGroup(t *testing.T) {
 		t.Fatalf("invalid error message: %s", err)
 	}
 }
+
+func TestDottedKeysExtendTable(t *testing.T) {
+	tree, err := Load("a.b.c = 1\na.b.d = 2\na.e = 3")
+	assertTree(t, tree, err, map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": map[string]interface{}{
+				"c": int64(1),
+				"d": int64(2),
+			},
+			"e": int64(3),
+		},
+	})
+}
+
+func TestDottedKeysRedefineValue(t *testing.T) {
+	_, err := Load("a.b = 1\na.b.c = 2")
+	if err == nil || err.Error() != "(2, 1): key a.b is already defined as a value, cannot define a.b.c" {
+		t.Errorf("Bad error message: %v", err)
+	}
+
+	_, err = Load("[x]\na = 1\na.b.c = 2")
+	if err == nil || err.Error() != "(3, 1): key x.a is already defined as a value, cannot define x.a.b.c" {
+		t.Errorf("Bad error message: %v", err)
+	}
+
+	_, err = Load("a = { b = 1, b.c = 2 }")
+	if err == nil || err.Error() != "(1, 14): key b is already defined as a value, cannot define b.c" {
+		t.Errorf("Bad error message: %v", err)
+	}
+}
+
+func TestKeyValuesOnSeparateLines(t *testing.T) {
+	tree, err := Load("a = 1\nb = \"two\" # comment\nc = [3]")
+	assertTree(t, tree, err, map[string]interface{}{
+		"a": int64(1),
+		"b": "two",
+		"c": []interface{}{int64(3)},
+	})
+
+	for doc, expected := range map[string]string{
+		"a = 1 b = 2":                "(1, 7): parsing error: a key/value pair must be followed by a newline",
+		"a = [1] b = 2":              "(1, 9): parsing error: a key/value pair must be followed by a newline",
+		"a = {x = 1} b = 2":          "(1, 13): parsing error: a key/value pair must be followed by a newline",
+		"a = \"\"\"x\ny\"\"\" b = 1": "(2, 6): parsing error: a key/value pair must be followed by a newline",
+		"[t] a = 1":                  "(1, 5): parsing error: a table header must be followed by a newline",
+		"[[t]] [u]":                  "(1, 7): parsing error: a table header must be followed by a newline",
+	} {
+		_, err := Load(doc)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", doc, expected, err)
+		}
+	}
+}
@@ -27,3 +27,32 @@ func (p Position) String() string {
 func (p Position) Invalid() bool {
 	return p.Line <= 0 || p.Col <= 0
 }
+
+// Span is the range of bytes [Start, End) of a document element within a
+// TOML document.
+type Span struct {
+	Start int // offset of the first byte of the element
+	End   int // offset of the byte following the element
+}
+
+// DecodeError is an error at a position of a TOML document, returned when the
+// document cannot be parsed or a value cannot be decoded. Its message starts
+// with the position, as in "(1, 5): expecting a value".
+type DecodeError struct {
+	Position Position
+	Msg      string
+}
+
+func (e *DecodeError) Error() string {
+	return e.Position.String() + ": " + e.Msg
+}
+
+// Line returns the 1-indexed line of the error.
+func (e *DecodeError) Line() int {
+	return e.Position.Line
+}
+
+// Column returns the 1-indexed column of the error.
+func (e *DecodeError) Column() int {
+	return e.Position.Col
+}
@@ -27,3 +27,40 @@ func TestInvalid(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeErrorPosition(t *testing.T) {
+	tests := []struct {
+		doc    string
+		line   int
+		column int
+		msg    string
+	}{
+		{"a", 1, 2, "was expecting token =, but got EOF instead"},
+		{"a = 1\nb = ", 2, 5, "expecting a value"},
+		{"a = 1\n[t]\nb = [1,,2]", 3, 8, "expected a value before comma in array"},
+		{"[t]\nkey = \"unclosed", 2, 8, "unclosed string"},
+		{"a = 1\na = 2", 2, 1, "The following key was defined twice: a"},
+	}
+	for _, test := range tests {
+		_, err := LoadBytes([]byte(test.doc))
+		decodeErr, ok := err.(*DecodeError)
+		if !ok {
+			t.Errorf("%q: expected a *DecodeError, got %#v", test.doc, err)
+			continue
+		}
+		if decodeErr.Line() != test.line || decodeErr.Column() != test.column || decodeErr.Msg != test.msg {
+			t.Errorf("%q: expected %d:%d %q, got %d:%d %q", test.doc, test.line, test.column, test.msg,
+				decodeErr.Line(), decodeErr.Column(), decodeErr.Msg)
+		}
+	}
+
+	var result struct {
+		Server struct {
+			Port int
+		}
+	}
+	err := Unmarshal([]byte("[server]\n\nport = \"http\""), &result)
+	if decodeErr, ok := err.(*DecodeError); !ok || decodeErr.Line() != 3 || decodeErr.Column() != 1 {
+		t.Errorf("expected a *DecodeError at 3:1, got %v", err)
+	}
+}
@@ -50,6 +50,10 @@
 //   ..*
 //                    Recursive selection of all nodes at this point in the
 //                    tree.
+//   ..leaves()
+//                    Recursive selection of all scalar values at this point
+//                    in the tree, including the elements of arrays. Tables
+//                    and arrays themselves are not selected.
 //   .*
 //                    Selects all children of the current node.
 //   [expr,expr]
@@ -58,10 +62,39 @@
 //   [start:end:step]
 //                    Slice operator - selects array elements from start to
 //                    end-1, at the given step.  All three arguments are
-//                    optional.
+//                    optional, and default to the whole array with a step
+//                    of 1, e.g. [::2] selects every other element.
 //   [?(filter)]
 //                    Named filter expression - the function 'filter' is
 //                    used to filter children at this node.
+//   [?(@.key)]
+//                    Relative filter expression - selects children of this
+//                    node that are tables defining 'key'. The key may be a
+//                    dotted path, e.g. @.server.enabled.
+//   [?(@.key op value)]
+//                    Comparison filter - selects children of this node that
+//                    are tables whose 'key' compares to value, an integer,
+//                    float, string or boolean. Supported operators are
+//                    <, <=, >, >=, == and !=; booleans only support == and
+//                    !=. Integers and floats compare with each other, but
+//                    other values of different types never match.
+//   [?(@.key op @.other)]
+//                    Field comparison filter - selects children of this node
+//                    that are tables whose 'key' compares to their 'other'
+//                    key, with the same operators and rules as above.
+//   [?(strlen(@.key) > n)]
+//                    String length filter - selects children of this node
+//                    that are tables whose string 'key' has a length
+//                    satisfying the comparison. Supported operators are
+//                    <, <=, >, >=, == and !=. Values which are not strings
+//                    fail the query, see Result.Err.
+//   [?(has(@, 'key'))]
+//                    Key membership filter - selects children of this node
+//                    that are tables containing 'key'. Unlike @.key, the key
+//                    is never split on dots.
+//   ^
+//                    Parent operator - selects the parent of this node. The
+//                    root has no parent, so selects nothing.
 //
 // Query Indexes And Slices
 //
@@ -109,6 +142,17 @@
 //   // returns children of foo that are permitted by the 'bar' filter.
 //   query.CompileAndExecute("$.foo[?(bar)]", tree)
 //
+// An index directly following a filter selects from the ordered set of
+// filtered children, rather than indexing into each child.
+//
+//   // returns the first server that defines 'active'
+//   query.CompileAndExecute("$.servers[?(@.active)][0]", tree)
+//
+// The parent operator selects the node a filtered child was found in.
+//
+//   // returns the servers that have an http table listening on port 80
+//   query.CompileAndExecute("$.servers.*[?(@.port == 80)]^", tree)
+//
 // There are several filters provided with the library:
 //
 //   tree
@@ -136,6 +180,22 @@
 //       fmt.Println("%v: %v", results.Positions()[idx], value)
 //   }
 //
+// Modifying Documents
+//
+// A compiled query may also be used to replace the nodes it matches. Replaced
+// values keep the position and comment of the original node.
+//
+//   query, _ := query.Compile("$.servers[0].port")
+//   err := query.Set(tree, int64(8080))
+//
+// Transform replaces each matched node with a value computed from it:
+//
+//   // double every integer of the document
+//   query, _ := query.Compile("$..[?(int)]")
+//   count, err := query.Transform(tree, func(node interface{}) interface{} {
+//       return node.(int64) * 2
+//   })
+//
 // Compiled Queries
 //
 // Queries may be executed directly on a Tree object, or compiled ahead
@@ -152,6 +212,15 @@
 //   // run the compiled query again on a different tree
 //   moreResults := query.Execute(anotherTree)
 //
+// The traversal of the tree can be bounded in time, for example when running
+// recursive queries on large documents, with ExecuteContext or ExecuteTimeout.
+//
+//   // give up after a second
+//   results, err := query.ExecuteTimeout(tree, time.Second)
+//
+// When the paths of a union overlap, the same node can be matched more than
+// once. ExecuteUnique returns each node only once.
+//
 // User Defined Query Filters
 //
 // Filter expressions may also be user defined by using the SetFilter()
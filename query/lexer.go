@@ -162,10 +162,20 @@ func (l *queryLexer) lexVoid() queryLexStateFn {
 			l.pos++
 			l.emit(tokenQuestion)
 			continue
+		case '@':
+			l.pos++
+			l.emit(tokenAt)
+			continue
 		case ':':
 			l.pos++
 			l.emit(tokenColon)
 			continue
+		case '^':
+			l.pos++
+			l.emit(tokenCaret)
+			continue
+		case '<', '>', '=', '!':
+			return l.lexOperator
 		case '\'':
 			l.ignore()
 			l.stringTerm = string(next)
@@ -200,6 +210,16 @@ func (l *queryLexer) lexVoid() queryLexStateFn {
 	return nil
 }
 
+// lex a comparison operator: <, <=, >, >=, == or !=
+func (l *queryLexer) lexOperator() queryLexStateFn {
+	first := l.next()
+	if !l.accept("=") && (first == '=' || first == '!') {
+		return l.errorf("expected '=' after '%c'", first)
+	}
+	l.emit(tokenOperator)
+	return l.lexVoid
+}
+
 func (l *queryLexer) lexKey() queryLexStateFn {
 	for {
 		next := l.peek()
@@ -173,7 +173,47 @@ func TestLexNumberWithoutDigit(t *testing.T) {
 }
 
 func TestLexUnknown(t *testing.T) {
-	testQLFlow(t, "^", []token{
-		{toml.Position{1, 1}, tokenError, "unexpected char: '94'"},
+	testQLFlow(t, "~", []token{
+		{toml.Position{1, 1}, tokenError, "unexpected char: '126'"},
+	})
+}
+
+func TestLexRelativeFilter(t *testing.T) {
+	testQLFlow(t, "$[?(@.foo)]", []token{
+		{toml.Position{1, 1}, tokenDollar, "$"},
+		{toml.Position{1, 2}, tokenLeftBracket, "["},
+		{toml.Position{1, 3}, tokenQuestion, "?"},
+		{toml.Position{1, 4}, tokenLeftParen, "("},
+		{toml.Position{1, 5}, tokenAt, "@"},
+		{toml.Position{1, 6}, tokenDot, "."},
+		{toml.Position{1, 7}, tokenKey, "foo"},
+		{toml.Position{1, 10}, tokenRightParen, ")"},
+		{toml.Position{1, 11}, tokenRightBracket, "]"},
+		{toml.Position{1, 12}, tokenEOF, ""},
+	})
+}
+
+func TestLexOperators(t *testing.T) {
+	testQLFlow(t, "< <= > >= == !=", []token{
+		{toml.Position{1, 1}, tokenOperator, "<"},
+		{toml.Position{1, 3}, tokenOperator, "<="},
+		{toml.Position{1, 6}, tokenOperator, ">"},
+		{toml.Position{1, 8}, tokenOperator, ">="},
+		{toml.Position{1, 11}, tokenOperator, "=="},
+		{toml.Position{1, 14}, tokenOperator, "!="},
+		{toml.Position{1, 16}, tokenEOF, ""},
+	})
+	testQLFlow(t, "!", []token{
+		{toml.Position{1, 1}, tokenError, "expected '=' after '!'"},
+	})
+}
+
+func TestLexCaret(t *testing.T) {
+	testQLFlow(t, "$.a^", []token{
+		{toml.Position{1, 1}, tokenDollar, "$"},
+		{toml.Position{1, 2}, tokenDot, "."},
+		{toml.Position{1, 3}, tokenKey, "a"},
+		{toml.Position{1, 4}, tokenCaret, "^"},
+		{toml.Position{1, 5}, tokenEOF, ""},
 	})
 }
@@ -2,6 +2,9 @@ package query
 
 import (
 	"fmt"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/pelletier/go-toml"
 )
 
@@ -28,7 +31,8 @@ func (f *terminatingFn) setNext(next pathFn) {
 }
 
 func (f *terminatingFn) call(node interface{}, ctx *queryContext) {
-	ctx.result.appendResult(node, ctx.lastPosition)
+	ctx.result.appendResult(node, ctx.lastPosition, ctx.lastLocation)
+	ctx.done = ctx.first
 }
 
 // match single key
@@ -43,19 +47,43 @@ func newMatchKeyFn(name string) *matchKeyFn {
 
 func (f *matchKeyFn) call(node interface{}, ctx *queryContext) {
 	if array, ok := node.([]*toml.Tree); ok {
-		for _, tree := range array {
-			item := tree.Get(f.Name)
-			if item != nil {
-				ctx.lastPosition = tree.GetPosition(f.Name)
-				f.next.call(item, ctx)
+		loc := ctx.childLocation(array)
+		for i, tree := range array {
+			if ctx.stopped() {
+				return
 			}
+			loc.index = i
+			ctx.lastPosition = tree.Position()
+			ctx.lastLocation = loc
+			f.callTree(tree, ctx)
 		}
 	} else if tree, ok := node.(*toml.Tree); ok {
-		item := tree.Get(f.Name)
-		if item != nil {
-			ctx.lastPosition = tree.GetPosition(f.Name)
-			f.next.call(item, ctx)
+		f.callTree(tree, ctx)
+	}
+}
+
+func (f *matchKeyFn) callTree(tree *toml.Tree, ctx *queryContext) {
+	loc := ctx.childLocation(tree)
+	if ctx.caseInsensitive {
+		for _, k := range tree.Keys() {
+			if ctx.stopped() {
+				return
+			}
+			if strings.EqualFold(k, f.Name) {
+				loc.key = k
+				ctx.lastPosition = tree.GetPosition(k)
+				ctx.lastLocation = loc
+				f.next.call(tree.GetPath([]string{k}), ctx)
+			}
 		}
+		return
+	}
+	item := tree.Get(f.Name)
+	if item != nil {
+		loc.key = f.Name
+		ctx.lastPosition = tree.GetPosition(f.Name)
+		ctx.lastLocation = loc
+		f.next.call(item, ctx)
 	}
 }
 
@@ -70,13 +98,20 @@ func newMatchIndexFn(idx int) *matchIndexFn {
 }
 
 func (f *matchIndexFn) call(node interface{}, ctx *queryContext) {
-	if arr, ok := node.([]interface{}); ok {
+	switch arr := node.(type) {
+	case []interface{}:
 		if f.Idx < len(arr) && f.Idx >= 0 {
-			if treesArray, ok := node.([]*toml.Tree); ok {
-				if len(treesArray) > 0 {
-					ctx.lastPosition = treesArray[0].Position()
-				}
-			}
+			loc := ctx.childLocation(arr)
+			loc.index = f.Idx
+			ctx.lastLocation = loc
+			f.next.call(arr[f.Idx], ctx)
+		}
+	case []*toml.Tree:
+		if f.Idx < len(arr) && f.Idx >= 0 {
+			loc := ctx.childLocation(arr)
+			loc.index = f.Idx
+			ctx.lastPosition = arr[f.Idx].Position()
+			ctx.lastLocation = loc
 			f.next.call(arr[f.Idx], ctx)
 		}
 	}
@@ -105,13 +140,23 @@ func (f *matchSliceFn) call(node interface{}, ctx *queryContext) {
 		if realEnd < realStart {
 			realEnd, realStart = realStart, realEnd // swap
 		}
+		// omitted or out of range bounds select up to the ends of the array
+		if realStart < 0 {
+			realStart = 0
+		}
+		if realEnd > len(arr) {
+			realEnd = len(arr)
+		}
 		// loop and gather
-		for idx := realStart; idx < realEnd; idx += f.Step {
+		loc := ctx.childLocation(arr)
+		for idx := realStart; idx < realEnd && !ctx.stopped(); idx += f.Step {
 			if treesArray, ok := node.([]*toml.Tree); ok {
 				if len(treesArray) > 0 {
 					ctx.lastPosition = treesArray[0].Position()
 				}
 			}
+			loc.index = idx
+			ctx.lastLocation = loc
 			f.next.call(arr[idx], ctx)
 		}
 	}
@@ -128,9 +173,15 @@ func newMatchAnyFn() *matchAnyFn {
 
 func (f *matchAnyFn) call(node interface{}, ctx *queryContext) {
 	if tree, ok := node.(*toml.Tree); ok {
+		loc := ctx.childLocation(tree)
 		for _, k := range tree.Keys() {
+			if ctx.stopped() {
+				return
+			}
 			v := tree.Get(k)
+			loc.key = k
 			ctx.lastPosition = tree.GetPosition(k)
+			ctx.lastLocation = loc
 			f.next.call(v, ctx)
 		}
 	}
@@ -149,6 +200,9 @@ func (f *matchUnionFn) setNext(next pathFn) {
 
 func (f *matchUnionFn) call(node interface{}, ctx *queryContext) {
 	for _, fn := range f.Union {
+		if ctx.stopped() {
+			return
+		}
 		fn.call(node, ctx)
 	}
 }
@@ -163,70 +217,392 @@ func newMatchRecursiveFn() *matchRecursiveFn {
 }
 
 func (f *matchRecursiveFn) call(node interface{}, ctx *queryContext) {
-	originalPosition := ctx.lastPosition
 	if tree, ok := node.(*toml.Tree); ok {
+		// visit the children of a tree, which the context is at
 		var visit func(tree *toml.Tree)
 		visit = func(tree *toml.Tree) {
+			loc := ctx.childLocation(tree)
 			for _, k := range tree.Keys() {
+				if ctx.stopped() {
+					return
+				}
 				v := tree.Get(k)
+				loc.key = k
 				ctx.lastPosition = tree.GetPosition(k)
+				ctx.lastLocation = loc
 				f.next.call(v, ctx)
 				switch node := v.(type) {
 				case *toml.Tree:
+					ctx.lastPosition = tree.GetPosition(k)
+					ctx.lastLocation = loc
 					visit(node)
 				case []*toml.Tree:
-					for _, subtree := range node {
+					ctx.lastPosition = tree.GetPosition(k)
+					ctx.lastLocation = loc
+					elem := ctx.childLocation(node)
+					for i, subtree := range node {
+						elem.index = i
+						ctx.lastPosition = subtree.Position()
+						ctx.lastLocation = elem
 						visit(subtree)
 					}
 				}
 			}
 		}
-		ctx.lastPosition = originalPosition
+		originalPosition := ctx.lastPosition
+		originalLocation := ctx.lastLocation
 		f.next.call(tree, ctx)
+		ctx.lastPosition = originalPosition
+		ctx.lastLocation = originalLocation
 		visit(tree)
 	}
 }
 
-// match based on an externally provided functional filter
+// match the parent of the current node
+type matchParentFn struct {
+	matchBase
+}
+
+func newMatchParentFn() *matchParentFn {
+	return &matchParentFn{}
+}
+
+func (f *matchParentFn) call(node interface{}, ctx *queryContext) {
+	loc := ctx.lastLocation
+	if loc.up == nil {
+		return // the root has no parent
+	}
+	ctx.lastLocation = *loc.up
+	ctx.lastPosition = loc.upPosition
+	f.next.call(loc.parent, ctx)
+}
+
+// match every scalar value under the current node, recursively, including
+// the elements of arrays; tables and arrays themselves are never matched
+type matchLeafFn struct {
+	matchBase
+}
+
+func newMatchLeafFn() *matchLeafFn {
+	return &matchLeafFn{}
+}
+
+func (f *matchLeafFn) call(node interface{}, ctx *queryContext) {
+	if tree, ok := node.(*toml.Tree); ok {
+		originalPosition := ctx.lastPosition
+		originalLocation := ctx.lastLocation
+		f.visit(tree, ctx)
+		ctx.lastPosition = originalPosition
+		ctx.lastLocation = originalLocation
+	}
+}
+
+func (f *matchLeafFn) visit(node interface{}, ctx *queryContext) {
+	switch castNode := node.(type) {
+	case *toml.Tree:
+		loc := ctx.childLocation(castNode)
+		for _, k := range castNode.Keys() {
+			if ctx.stopped() {
+				return
+			}
+			loc.key = k
+			ctx.lastPosition = castNode.GetPosition(k)
+			ctx.lastLocation = loc
+			f.visit(castNode.Get(k), ctx)
+		}
+	case []*toml.Tree:
+		loc := ctx.childLocation(castNode)
+		for i, tree := range castNode {
+			if ctx.stopped() {
+				return
+			}
+			loc.index = i
+			ctx.lastPosition = tree.Position()
+			ctx.lastLocation = loc
+			f.visit(tree, ctx)
+		}
+	case []interface{}:
+		position := ctx.lastPosition
+		loc := ctx.childLocation(castNode)
+		for i, v := range castNode {
+			if ctx.stopped() {
+				return
+			}
+			loc.index = i
+			ctx.lastPosition = position
+			ctx.lastLocation = loc
+			f.visit(v, ctx)
+		}
+	default:
+		f.next.call(node, ctx)
+	}
+}
+
+// match based on an externally provided functional filter, or on a filter
+// compiled from the query expression itself
 type matchFilterFn struct {
 	matchBase
 	Pos  toml.Position
 	Name string
+	fn   NodeFilterFn
+	// reports the nodes fn cannot be applied to, which fail the query
+	check func(node interface{}) error
 }
 
 func newMatchFilterFn(name string, pos toml.Position) *matchFilterFn {
 	return &matchFilterFn{Name: name, Pos: pos}
 }
 
+// filter keeping trees that define the given relative path
+func newMatchRelativeFilterFn(path []string, pos toml.Position) *matchFilterFn {
+	return &matchFilterFn{
+		Name: "@." + strings.Join(path, "."),
+		Pos:  pos,
+		fn: func(node interface{}) bool {
+			tree, ok := node.(*toml.Tree)
+			return ok && tree.HasPath(path)
+		},
+	}
+}
+
+// filter keeping trees that define the given key, which is never split on
+// dots
+func newMatchHasFilterFn(key string, pos toml.Position) *matchFilterFn {
+	return &matchFilterFn{
+		Name: fmt.Sprintf("has(@, %q)", key),
+		Pos:  pos,
+		fn: func(node interface{}) bool {
+			tree, ok := node.(*toml.Tree)
+			return ok && tree.HasPath([]string{key})
+		},
+	}
+}
+
+// filter keeping trees whose string value at the given relative path has a
+// length satisfying the comparison; other value types fail the query
+func newMatchStrlenFilterFn(path []string, op string, length int, pos toml.Position) *matchFilterFn {
+	return &matchFilterFn{
+		Name: fmt.Sprintf("strlen(@.%s) %s %d", strings.Join(path, "."), op, length),
+		Pos:  pos,
+		fn: func(node interface{}) bool {
+			tree, ok := node.(*toml.Tree)
+			if !ok || !tree.HasPath(path) {
+				return false
+			}
+			str := tree.GetPath(path).(string)
+			return compareInts(utf8.RuneCountInString(str), op, length)
+		},
+		check: func(node interface{}) error {
+			tree, ok := node.(*toml.Tree)
+			if !ok || !tree.HasPath(path) {
+				return nil
+			}
+			value := tree.GetPath(path)
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("%s: strlen expects a string at @.%s, got %T",
+					tree.GetPositionPath(path), strings.Join(path, "."), value)
+			}
+			return nil
+		},
+	}
+}
+
+// apply a comparison operator, as lexed by lexOperator
+func compareInts(a int, op string, b int) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "==":
+		return a == b
+	default: // "!="
+		return a != b
+	}
+}
+
+// filter keeping trees whose value at the given relative path satisfies the
+// comparison with a literal; values of different types never match, except
+// integers and floats which are compared as floats
+func newMatchCompareFilterFn(path []string, op string, literal interface{}, pos toml.Position) *matchFilterFn {
+	return &matchFilterFn{
+		Name: fmt.Sprintf("@.%s %s %v", strings.Join(path, "."), op, literal),
+		Pos:  pos,
+		fn: func(node interface{}) bool {
+			tree, ok := node.(*toml.Tree)
+			if !ok || !tree.HasPath(path) {
+				return false
+			}
+			return compareValues(tree.GetPath(path), op, literal)
+		},
+	}
+}
+
+// filter keeping trees whose values at both relative paths satisfy the
+// comparison, with the same rules as newMatchCompareFilterFn
+func newMatchPathsCompareFilterFn(path []string, op string, other []string, pos toml.Position) *matchFilterFn {
+	return &matchFilterFn{
+		Name: fmt.Sprintf("@.%s %s @.%s", strings.Join(path, "."), op, strings.Join(other, ".")),
+		Pos:  pos,
+		fn: func(node interface{}) bool {
+			tree, ok := node.(*toml.Tree)
+			if !ok || !tree.HasPath(path) || !tree.HasPath(other) {
+				return false
+			}
+			return compareValues(tree.GetPath(path), op, tree.GetPath(other))
+		},
+	}
+}
+
+// apply a comparison operator to two scalar values
+func compareValues(a interface{}, op string, b interface{}) bool {
+	switch av := a.(type) {
+	case int64:
+		switch bv := b.(type) {
+		case int64:
+			return compareInts(compareInt64(av, bv), op, 0)
+		case float64:
+			return compareFloats(float64(av), op, bv)
+		}
+	case float64:
+		switch bv := b.(type) {
+		case int64:
+			return compareFloats(av, op, float64(bv))
+		case float64:
+			return compareFloats(av, op, bv)
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return compareInts(strings.Compare(av, bv), op, 0)
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			switch op {
+			case "==":
+				return av == bv
+			case "!=":
+				return av != bv
+			}
+		}
+	}
+	return false
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// floats are not mapped to an ordering so that NaN never compares true,
+// except for !=
+func compareFloats(a float64, op string, b float64) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "==":
+		return a == b
+	default: // "!="
+		return a != b
+	}
+}
+
+// a node selected by a filter, along with where it was found
+type filterMatch struct {
+	value    interface{}
+	position toml.Position
+	location nodeLocation
+}
+
+// applies fn to node, failing the query instead if the check of the filter
+// rejects node
+func (f *matchFilterFn) apply(fn NodeFilterFn, node interface{}, ctx *queryContext) bool {
+	if f.check != nil {
+		if err := f.check(node); err != nil {
+			ctx.fail(err)
+			return false
+		}
+	}
+	return fn(node)
+}
+
 func (f *matchFilterFn) call(node interface{}, ctx *queryContext) {
-	fn, ok := (*ctx.filters)[f.Name]
-	if !ok {
-		panic(fmt.Sprintf("%s: query context does not have filter '%s'",
-			f.Pos.String(), f.Name))
+	fn := f.fn
+	if fn == nil {
+		var ok bool
+		fn, ok = (*ctx.filters)[f.Name]
+		if !ok {
+			panic(fmt.Sprintf("%s: query context does not have filter '%s'",
+				f.Pos.String(), f.Name))
+		}
 	}
+	// only containers are filtered; scalars have no children to select
+	var matched []filterMatch
+	loc := ctx.childLocation(node)
 	switch castNode := node.(type) {
 	case *toml.Tree:
 		for _, k := range castNode.Keys() {
+			if ctx.stopped() {
+				return
+			}
 			v := castNode.Get(k)
-			if fn(v) {
-				ctx.lastPosition = castNode.GetPosition(k)
-				f.next.call(v, ctx)
+			if f.apply(fn, v, ctx) {
+				loc.key = k
+				matched = append(matched, filterMatch{v, castNode.GetPosition(k), loc})
 			}
 		}
 	case []*toml.Tree:
-		for _, v := range castNode {
-			if fn(v) {
-				if len(castNode) > 0 {
-					ctx.lastPosition = castNode[0].Position()
-				}
-				f.next.call(v, ctx)
+		for i, v := range castNode {
+			if ctx.stopped() {
+				return
+			}
+			if f.apply(fn, v, ctx) {
+				loc.index = i
+				matched = append(matched, filterMatch{v, castNode[0].Position(), loc})
 			}
 		}
 	case []interface{}:
-		for _, v := range castNode {
-			if fn(v) {
-				f.next.call(v, ctx)
+		for i, v := range castNode {
+			if ctx.stopped() {
+				return
+			}
+			if f.apply(fn, v, ctx) {
+				loc.index = i
+				matched = append(matched, filterMatch{v, ctx.lastPosition, loc})
 			}
 		}
 	}
+
+	// an index following a filter selects from the ordered filtered results
+	// rather than from each match individually
+	next := f.next
+	if idx, ok := next.(*matchIndexFn); ok {
+		if idx.Idx < 0 || idx.Idx >= len(matched) {
+			return
+		}
+		matched = matched[idx.Idx : idx.Idx+1]
+		next = idx.next
+	}
+	for _, m := range matched {
+		if ctx.stopped() {
+			return
+		}
+		ctx.lastPosition = m.position
+		ctx.lastLocation = m.location
+		next.call(m.value, ctx)
+	}
 }
@@ -54,7 +54,7 @@ func assertPathMatch(t *testing.T, path, ref *Query) bool {
 }
 
 func assertPath(t *testing.T, query string, ref *Query) {
-	path, _ := parseQuery(lexQuery(query))
+	path, _ := parseQuery(query, CompileOptions{})
 	assertPathMatch(t, path, ref)
 }
 
@@ -200,3 +200,11 @@ func TestPathFilterExpr(t *testing.T) {
 			}},
 		))
 }
+
+func TestPathFilterRelativeExpr(t *testing.T) {
+	assertPath(t,
+		"$[?(@.foo.bar)]",
+		buildPath(
+			newMatchRelativeFilterFn([]string{"foo", "bar"}, toml.Position{}),
+		))
+}
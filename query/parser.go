@@ -9,6 +9,10 @@ package query
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
 )
 
 const maxInt = int(^uint(0) >> 1)
@@ -18,14 +22,46 @@ type queryParser struct {
 	tokensBuffer []token
 	query        *Query
 	union        []pathFn
-	err          error
+	err          *PathError
+	options      CompileOptions
 }
 
 type queryParserStateFn func() queryParserStateFn
 
+// PathError is the error returned by Compile for a malformed path
+// expression.
+type PathError struct {
+	Path     string        // path expression being compiled
+	Position toml.Position // line and column of the failure within Path
+	Offset   int           // offset in characters of the failure within Path
+	Msg      string
+}
+
+// Error renders the message, followed by the line of the path where the
+// failure occurred and a caret pointing at it:
+//
+//	(1, 5): unknown filter function 'len'
+//	$[?(len(@.name) > 1)]
+//	    ^
+func (e *PathError) Error() string {
+	line := e.Path
+	if lines := strings.Split(e.Path, "\n"); e.Position.Line >= 1 && e.Position.Line <= len(lines) {
+		line = lines[e.Position.Line-1]
+	}
+	indent := e.Position.Col - 1
+	if indent < 0 {
+		indent = 0
+	}
+	caret := strings.Repeat(" ", indent) + "^"
+	return fmt.Sprintf("%s: %s\n%s\n%s", e.Position, e.Msg, line, caret)
+}
+
 // Formats and panics an error message based on a token
 func (p *queryParser) parseError(tok *token, msg string, args ...interface{}) queryParserStateFn {
-	p.err = fmt.Errorf(tok.Position.String()+": "+msg, args...)
+	p.err = &PathError{
+		Position: tok.Position,
+		Msg:      fmt.Sprintf(msg, args...),
+	}
 	return nil // trigger parse to end
 }
 
@@ -105,6 +141,16 @@ func (p *queryParser) parseMatchExpr() queryParserStateFn {
 	tok := p.getToken()
 	switch tok.typ {
 	case tokenDotDot:
+		if p.options.DisallowRecursive {
+			return p.parseError(tok, "recursive descent is not allowed")
+		}
+		if p.lookahead(tokenKey, tokenLeftParen, tokenRightParen) && p.peek().val == "leaves" {
+			p.getToken() // 'leaves'
+			p.getToken() // '('
+			p.getToken() // ')'
+			p.query.appendPath(newMatchLeafFn())
+			return p.parseMatchExpr
+		}
 		p.query.appendPath(&matchRecursiveFn{})
 		// nested parse for '..'
 		tok := p.getToken()
@@ -134,6 +180,10 @@ func (p *queryParser) parseMatchExpr() queryParserStateFn {
 	case tokenLeftBracket:
 		return p.parseBracketExpr
 
+	case tokenCaret:
+		p.query.appendPath(newMatchParentFn())
+		return p.parseMatchExpr
+
 	case tokenEOF:
 		return nil // allow EOF at this stage
 	}
@@ -233,7 +283,7 @@ func (p *queryParser) parseSliceExpr() queryParserStateFn {
 	tok = p.getToken()
 	if tok.typ == tokenInteger {
 		step = tok.Int()
-		if step < 0 {
+		if step <= 0 {
 			return p.parseError(tok, "step must be a positive value")
 		}
 		tok = p.getToken()
@@ -252,6 +302,12 @@ func (p *queryParser) parseFilterExpr() queryParserStateFn {
 		return p.parseError(tok, "expected left-parenthesis for filter expression")
 	}
 	tok = p.getToken()
+	if tok.typ == tokenAt {
+		return p.parseRelativeFilterExpr(tok)
+	}
+	if tok.typ == tokenKey && p.lookahead(tokenLeftParen) {
+		return p.parseFilterFunctionExpr(tok)
+	}
 	if tok.typ != tokenKey && tok.typ != tokenString {
 		return p.parseError(tok, "expected key or string for filter function name")
 	}
@@ -264,12 +320,190 @@ func (p *queryParser) parseFilterExpr() queryParserStateFn {
 	return p.parseUnionExpr
 }
 
-func parseQuery(flow chan token) (*Query, error) {
+// parse the '.key.key' path following '@' in a filter expression; returns
+// the path and the token following it, or nil if a parse error was raised
+func (p *queryParser) parseRelativePath() ([]string, *token) {
+	path := []string{}
+	tok := p.getToken()
+	for tok.typ == tokenDot {
+		tok = p.getToken()
+		if tok.typ != tokenKey && tok.typ != tokenString {
+			p.parseError(tok, "expected key or string after '.' in filter expression")
+			return nil, nil
+		}
+		path = append(path, tok.val)
+		tok = p.getToken()
+	}
+	if len(path) == 0 {
+		p.parseError(tok, "expected '.' after '@' in filter expression")
+		return nil, nil
+	}
+	return path, tok
+}
+
+// handle '@.key.key' inside a filter expression, selecting nodes that are
+// trees defining the given relative path
+func (p *queryParser) parseRelativeFilterExpr(at *token) queryParserStateFn {
+	path, tok := p.parseRelativePath()
+	if tok == nil {
+		return nil
+	}
+	if tok.typ == tokenOperator {
+		return p.parseCompareExpr(at, path, tok)
+	}
+	if tok.typ != tokenRightParen {
+		return p.parseError(tok, "expected right-parenthesis for filter expression")
+	}
+	p.union = append(p.union, newMatchRelativeFilterFn(path, at.Position))
+	return p.parseUnionExpr
+}
+
+// handle '@.key.key op literal' inside a filter expression, where the literal
+// is an integer, a float, a string, true or false, or another relative path
+// such as '@.min < @.max'
+func (p *queryParser) parseCompareExpr(at *token, path []string, op *token) queryParserStateFn {
+	tok := p.getToken()
+	if tok.typ == tokenAt {
+		other, tok := p.parseRelativePath()
+		if tok == nil {
+			return nil
+		}
+		if tok.typ != tokenRightParen {
+			return p.parseError(tok, "expected right-parenthesis for filter expression")
+		}
+		p.union = append(p.union, newMatchPathsCompareFilterFn(path, op.val, other, at.Position))
+		return p.parseUnionExpr
+	}
+	var literal interface{}
+	switch {
+	case tok.typ == tokenInteger:
+		v, err := strconv.ParseInt(tok.val, 10, 64)
+		if err != nil {
+			return p.parseError(tok, "invalid integer %s: %s", tok.val, err)
+		}
+		literal = v
+	case tok.typ == tokenFloat:
+		v, err := strconv.ParseFloat(tok.val, 64)
+		if err != nil {
+			return p.parseError(tok, "invalid float %s: %s", tok.val, err)
+		}
+		literal = v
+	case tok.typ == tokenString:
+		literal = tok.val
+	case tok.typ == tokenKey && (tok.val == "true" || tok.val == "false"):
+		if op.val != "==" && op.val != "!=" {
+			return p.parseError(op, "booleans can only be compared with == or !=")
+		}
+		literal = tok.val == "true"
+	default:
+		return p.parseError(tok, "expected integer, float, string, boolean or '@' after %s", op.val)
+	}
+	tok = p.getToken()
+	if tok.typ != tokenRightParen {
+		return p.parseError(tok, "expected right-parenthesis for filter expression")
+	}
+	p.union = append(p.union, newMatchCompareFilterFn(path, op.val, literal, at.Position))
+	return p.parseUnionExpr
+}
+
+// handle a built-in function call inside a filter expression, such as
+// 'strlen(@.key) > 3' or 'has(@, "key")'
+func (p *queryParser) parseFilterFunctionExpr(name *token) queryParserStateFn {
+	switch name.val {
+	case "strlen":
+		return p.parseStrlenExpr(name)
+	case "has":
+		return p.parseHasExpr(name)
+	default:
+		return p.parseError(name, "unknown filter function '%s'", name.val)
+	}
+}
+
+func (p *queryParser) parseStrlenExpr(name *token) queryParserStateFn {
+	p.getToken() // '('
+	tok := p.getToken()
+	if tok.typ != tokenAt {
+		return p.parseError(tok, "expected '@' as argument of %s", name.val)
+	}
+	path, tok := p.parseRelativePath()
+	if tok == nil {
+		return nil
+	}
+	if tok.typ != tokenRightParen {
+		return p.parseError(tok, "expected right-parenthesis after %s argument", name.val)
+	}
+	op := p.getToken()
+	if op.typ != tokenOperator {
+		return p.parseError(op, "expected comparison operator after %s()", name.val)
+	}
+	tok = p.getToken()
+	if tok.typ != tokenInteger {
+		return p.parseError(tok, "expected integer to compare %s() against", name.val)
+	}
+	length := tok.Int()
+	tok = p.getToken()
+	if tok.typ != tokenRightParen {
+		return p.parseError(tok, "expected right-parenthesis for filter expression")
+	}
+	p.union = append(p.union, newMatchStrlenFilterFn(path, op.val, length, name.Position))
+	return p.parseUnionExpr
+}
+
+func (p *queryParser) parseHasExpr(name *token) queryParserStateFn {
+	p.getToken() // '('
+	tok := p.getToken()
+	if tok.typ != tokenAt {
+		return p.parseError(tok, "expected '@' as first argument of %s", name.val)
+	}
+	tok = p.getToken()
+	if tok.typ != tokenComma {
+		return p.parseError(tok, "expected ',' after '@' in %s", name.val)
+	}
+	key := p.getToken()
+	if key.typ != tokenKey && key.typ != tokenString {
+		return p.parseError(key, "expected key or string as second argument of %s", name.val)
+	}
+	tok = p.getToken()
+	if tok.typ != tokenRightParen {
+		return p.parseError(tok, "expected right-parenthesis after %s arguments", name.val)
+	}
+	tok = p.getToken()
+	if tok.typ != tokenRightParen {
+		return p.parseError(tok, "expected right-parenthesis for filter expression")
+	}
+	p.union = append(p.union, newMatchHasFilterFn(key.val, name.Position))
+	return p.parseUnionExpr
+}
+
+func parseQuery(path string, options CompileOptions) (*Query, error) {
 	parser := &queryParser{
-		flow:         flow,
+		flow:         lexQuery(path),
 		tokensBuffer: []token{},
 		query:        newQuery(),
+		options:      options,
 	}
 	parser.run()
-	return parser.query, parser.err
+	if parser.err != nil {
+		parser.err.Path = path
+		parser.err.Offset = offsetOf(path, parser.err.Position)
+		return parser.query, parser.err
+	}
+	return parser.query, nil
+}
+
+// offset in characters of the given position within s
+func offsetOf(s string, pos toml.Position) int {
+	line, col := 1, 1
+	for offset, r := range []rune(s) {
+		if line == pos.Line && col == pos.Col {
+			return offset
+		}
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return len([]rune(s))
 }
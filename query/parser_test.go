@@ -1,6 +1,7 @@
 package query
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"sort"
@@ -179,6 +180,31 @@ func TestQuerySliceStep(t *testing.T) {
 		})
 }
 
+func TestQuerySliceDefaultBounds(t *testing.T) {
+	doc := "[foo]\na = [1,2,3,4,5,6,7,8,9,0]"
+	for query, expected := range map[string][]int64{
+		"$.foo.a[::2]":   {1, 3, 5, 7, 9},
+		"$.foo.a[1::2]":  {2, 4, 6, 8, 0},
+		"$.foo.a[:4:2]":  {1, 3},
+		"$.foo.a[8:]":    {9, 0},
+		"$.foo.a[7:100]": {8, 9, 0},
+	} {
+		var ref []interface{}
+		for _, value := range expected {
+			ref = append(ref, queryTestNode{value, toml.Position{2, 1}})
+		}
+		assertQueryPositions(t, doc, query, ref)
+	}
+}
+
+func TestQuerySliceZeroStep(t *testing.T) {
+	_, err := Compile("$.foo.a[::0]")
+	expected := "(1, 11): step must be a positive value"
+	if err == nil || strings.SplitN(err.Error(), "\n", 2)[0] != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
 func TestQueryAny(t *testing.T) {
 	assertQueryPositions(t,
 		"[foo.bar]\na=1\nb=2\n[foo.baz]\na=3\nb=4",
@@ -480,3 +506,335 @@ func TestQueryFilterFn(t *testing.T) {
 			},
 		})
 }
+
+func TestQueryAnyThenRelativeFilter(t *testing.T) {
+	assertQueryPositions(t,
+		"name = \"root\"\ncount = 3\n[servers]\nport = 80\n[servers.alpha]\nenabled = true\n[servers.beta]\nip = \"10.0.0.2\"",
+		"$.*[?(@.enabled)]",
+		[]interface{}{
+			queryTestNode{
+				map[string]interface{}{
+					"enabled": true,
+				}, toml.Position{5, 1},
+			},
+		})
+}
+
+func TestQueryRelativeFilterNestedPath(t *testing.T) {
+	assertQueryPositions(t,
+		"[a.opts]\nenabled = true\n[b]\nenabled = true\n[c.opts]\nother = 1",
+		"$[?(@.opts.enabled)]",
+		[]interface{}{
+			queryTestNode{
+				map[string]interface{}{
+					"opts": map[string]interface{}{
+						"enabled": true,
+					},
+				}, toml.Position{1, 1},
+			},
+		})
+}
+
+func TestQueryFilterThenIndex(t *testing.T) {
+	assertQueryPositions(t,
+		"[[servers]]\nname = \"a\"\n[[servers]]\nname = \"b\"\nactive = true\n[[servers]]\nname = \"c\"\nactive = true",
+		"$.servers[?(@.active)][0]",
+		[]interface{}{
+			queryTestNode{
+				map[string]interface{}{
+					"name":   "b",
+					"active": true,
+				}, toml.Position{1, 1},
+			},
+		})
+}
+
+func TestQueryFilterThenIndexOutOfRange(t *testing.T) {
+	assertQueryPositions(t,
+		"[[servers]]\nname = \"a\"\n[[servers]]\nname = \"b\"\nactive = true",
+		"$.servers[?(@.active)][1]",
+		[]interface{}{})
+}
+
+func TestQueryStrlenFilter(t *testing.T) {
+	assertQueryPositions(t,
+		"[[users]]\nname = \"bob\"\n[[users]]\nname = \"bartholomew\"\n[[users]]\nid = 3",
+		"$.users[?(strlen(@.name) > 10)]",
+		[]interface{}{
+			queryTestNode{
+				map[string]interface{}{
+					"name": "bartholomew",
+				}, toml.Position{1, 1},
+			},
+		})
+	assertQueryPositions(t,
+		"[[users]]\nname = \"bob\"\n[[users]]\nname = \"bartholomew\"",
+		"$.users[?(strlen(@.name) <= 3)].name",
+		[]interface{}{
+			queryTestNode{"bob", toml.Position{2, 1}},
+		})
+}
+
+func TestQueryStrlenFilterNotString(t *testing.T) {
+	tree, _ := toml.Load("[[users]]\nname = 42\n[[users]]\nname = \"bob\"")
+	q, _ := Compile("$.users[?(strlen(@.name) > 1)].name")
+	expected := "(2, 1): strlen expects a string at @.name, got int64"
+
+	if err := q.Execute(tree).Err(); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+	if _, err := q.ExecuteContext(context.Background(), tree); err == nil || err.Error() != expected {
+		t.Errorf("expected error %q from ExecuteContext, got %v", expected, err)
+	}
+	if err := q.Set(tree, "alice"); err == nil || tree.Get("users").([]*toml.Tree)[1].Get("name") != "bob" {
+		t.Errorf("expected Set to fail without replacing anything, got %v", err)
+	}
+}
+
+func TestQueryFilterFunctionErrors(t *testing.T) {
+	for query, expected := range map[string]string{
+		"$[?(len(@.name) > 1)]":        "(1, 5): unknown filter function 'len'",
+		"$[?(strlen(name) > 1)]":       "(1, 12): expected '@' as argument of strlen",
+		"$[?(strlen(@.name))]":         "(1, 19): expected comparison operator after strlen()",
+		"$[?(strlen(@.name) > 'a')]":   "(1, 23): expected integer to compare strlen() against",
+		"$[?(strlen(@.name) = 1)]":     "(1, 20): expected comparison operator after strlen()",
+		"$[?(strlen(@.name) > 1 foo)]": "(1, 24): expected right-parenthesis for filter expression",
+	} {
+		_, err := Compile(query)
+		if err == nil || strings.SplitN(err.Error(), "\n", 2)[0] != expected {
+			t.Errorf("%s: expected error %q, got %v", query, expected, err)
+		}
+	}
+}
+
+func TestQueryPathError(t *testing.T) {
+	for _, test := range []struct {
+		path   string
+		offset int
+		err    string
+	}{
+		{"foo", 0, "(1, 1): Expected '$' at start of expression\nfoo\n^"},
+		{"$.foo[1", 7, "(1, 8): expected ',' or ']', not ''\n$.foo[1\n       ^"},
+		{"$[?(@.a", 7, "(1, 8): expected right-parenthesis for filter expression\n$[?(@.a\n       ^"},
+		{"$.a.b[?(foo", 11, "(1, 12): expected right-parenthesis for filter expression\n$.a.b[?(foo\n           ^"},
+	} {
+		_, err := Compile(test.path)
+		pathErr, ok := err.(*PathError)
+		if !ok {
+			t.Errorf("%q: expected a *PathError, got %v", test.path, err)
+			continue
+		}
+		if pathErr.Path != test.path || pathErr.Offset != test.offset {
+			t.Errorf("%q: expected offset %d, got %d", test.path, test.offset, pathErr.Offset)
+		}
+		if pathErr.Error() != test.err {
+			t.Errorf("%q: expected error\n%s\ngot\n%s", test.path, test.err, pathErr.Error())
+		}
+	}
+
+	if err := (&PathError{Msg: "oops"}).Error(); err != "(0, 0): oops\n\n^" {
+		t.Errorf("expected a zero PathError to format, got %q", err)
+	}
+}
+
+func TestQueryHasFilter(t *testing.T) {
+	assertQueryPositions(t,
+		"[web]\nport = 80\n[db]\nhost = \"db1\"\n[proxy]\n\"tls.port\" = 443",
+		"$[?(has(@, 'port'))]",
+		[]interface{}{
+			queryTestNode{
+				map[string]interface{}{
+					"port": int64(80),
+				}, toml.Position{1, 1},
+			},
+		})
+	assertQueryPositions(t,
+		"[web]\nport = 80\n[db]\nhost = \"db1\"\n[proxy]\n\"tls.port\" = 443",
+		"$[?(has(@, \"tls.port\"))]",
+		[]interface{}{
+			queryTestNode{
+				map[string]interface{}{
+					"tls.port": int64(443),
+				}, toml.Position{5, 1},
+			},
+		})
+}
+
+func TestQueryHasFilterErrors(t *testing.T) {
+	for query, expected := range map[string]string{
+		"$[?(has(port))]":        "(1, 9): expected '@' as first argument of has",
+		"$[?(has(@))]":           "(1, 10): expected ',' after '@' in has",
+		"$[?(has(@, 1))]":        "(1, 12): expected key or string as second argument of has",
+		"$[?(has(@, 'a', 'b'))]": "(1, 15): expected right-parenthesis after has arguments",
+		"$[?(has(@, 'a')]":       "(1, 16): expected right-parenthesis for filter expression",
+	} {
+		_, err := Compile(query)
+		if err == nil || strings.SplitN(err.Error(), "\n", 2)[0] != expected {
+			t.Errorf("%s: expected error %q, got %v", query, expected, err)
+		}
+	}
+}
+
+func TestQueryParent(t *testing.T) {
+	assertQueryPositions(t,
+		"[servers.alpha.http]\nport = 80\n[servers.beta.http]\nport = 8080",
+		"$.servers.*[?(@.port == 80)]^",
+		[]interface{}{
+			queryTestNode{
+				map[string]interface{}{
+					"http": map[string]interface{}{
+						"port": int64(80),
+					},
+				}, toml.Position{1, 1},
+			},
+		})
+	assertQueryPositions(t,
+		"[[fruit]]\nname = \"apple\"\n[[fruit]]\nname = \"banana\"",
+		"$.fruit[1].name^",
+		[]interface{}{
+			queryTestNode{
+				map[string]interface{}{"name": "banana"},
+				toml.Position{3, 1},
+			},
+		})
+	assertQueryPositions(t, "a = 1", "$^", []interface{}{})
+}
+
+func TestQueryCompareFilter(t *testing.T) {
+	doc := "[a]\nport = 80\nname = \"web\"\nratio = 0.5\ntls = true\n" +
+		"[b]\nport = 443\nname = \"secure\"\nratio = 2\ntls = false"
+	nodeA := queryTestNode{
+		map[string]interface{}{
+			"port":  int64(80),
+			"name":  "web",
+			"ratio": 0.5,
+			"tls":   true,
+		}, toml.Position{1, 1},
+	}
+	nodeB := queryTestNode{
+		map[string]interface{}{
+			"port":  int64(443),
+			"name":  "secure",
+			"ratio": int64(2),
+			"tls":   false,
+		}, toml.Position{6, 1},
+	}
+	for query, expected := range map[string][]interface{}{
+		"$[?(@.port == 80)]":    {nodeA},
+		"$[?(@.port > 80)]":     {nodeB},
+		"$[?(@.port != 1)]":     {nodeA, nodeB},
+		"$[?(@.ratio < 1.5)]":   {nodeA},
+		"$[?(@.ratio >= 2)]":    {nodeB},
+		"$[?(@.name == 'web')]": {nodeA},
+		"$[?(@.name < \"t\")]":  {nodeB},
+		"$[?(@.tls == true)]":   {nodeA},
+		"$[?(@.tls != true)]":   {nodeB},
+		"$[?(@.name == 80)]":    {},
+		"$[?(@.missing == 80)]": {},
+	} {
+		assertQueryPositions(t, doc, query, expected)
+	}
+}
+
+func TestQueryComparePathsFilter(t *testing.T) {
+	doc := "[[ranges]]\nmin = 1\nmax = 5\n[[ranges]]\nmin = 7\nmax = 3\n" +
+		"[[ranges]]\nmin = 2.5\nmax = 4\n[[ranges]]\nmin = 4\n"
+	first := queryTestNode{
+		map[string]interface{}{"min": int64(1), "max": int64(5)}, toml.Position{1, 1},
+	}
+	second := queryTestNode{
+		map[string]interface{}{"min": int64(7), "max": int64(3)}, toml.Position{1, 1},
+	}
+	third := queryTestNode{
+		map[string]interface{}{"min": 2.5, "max": int64(4)}, toml.Position{1, 1},
+	}
+	fourth := queryTestNode{
+		map[string]interface{}{"min": int64(4)}, toml.Position{1, 1},
+	}
+	for query, expected := range map[string][]interface{}{
+		"$.ranges[?(@.min < @.max)]":     {first, third},
+		"$.ranges[?(@.min >= @.max)]":    {second},
+		"$.ranges[?(@.min == @.min)]":    {first, second, third, fourth},
+		"$.ranges[?(@.min < @.missing)]": {},
+		"$.ranges[?(@.missing < @.max)]": {},
+		"$.ranges[?(@.max > @.min)].min": {queryTestNode{int64(1), toml.Position{2, 1}}, queryTestNode{2.5, toml.Position{8, 1}}},
+	} {
+		assertQueryPositions(t, doc, query, expected)
+	}
+
+	_, err := Compile("$[?(@.min < @)]")
+	if err == nil || !strings.HasPrefix(err.Error(), "(1, 14): expected '.' after '@' in filter expression") {
+		t.Errorf("expected a relative path error, got %v", err)
+	}
+}
+
+func TestQueryCompareFilterErrors(t *testing.T) {
+	for query, expected := range map[string]string{
+		"$[?(@.a == )]":    "(1, 12): expected integer, float, string, boolean or '@' after ==",
+		"$[?(@.a < true)]": "(1, 9): booleans can only be compared with == or !=",
+		"$[?(@.a == 1 2)]": "(1, 14): expected right-parenthesis for filter expression",
+		"$[?(@.a == nil)]": "(1, 12): expected integer, float, string, boolean or '@' after ==",
+	} {
+		_, err := Compile(query)
+		if err == nil || strings.SplitN(err.Error(), "\n", 2)[0] != expected {
+			t.Errorf("%s: expected error %q, got %v", query, expected, err)
+		}
+	}
+}
+
+func TestQueryLeaves(t *testing.T) {
+	assertQueryPositions(t,
+		"title = \"doc\"\n[server]\nhost = \"localhost\"\nports = [80, 443]\n"+
+			"[server.tls]\nenabled = true\n[[users]]\nname = \"tom\"\n[[users]]\nname = \"ann\"",
+		"$..leaves()",
+		[]interface{}{
+			queryTestNode{"doc", toml.Position{1, 1}},
+			queryTestNode{"localhost", toml.Position{3, 1}},
+			queryTestNode{int64(80), toml.Position{4, 1}},
+			queryTestNode{int64(443), toml.Position{4, 1}},
+			queryTestNode{true, toml.Position{6, 1}},
+			queryTestNode{"tom", toml.Position{8, 1}},
+			queryTestNode{"ann", toml.Position{10, 1}},
+		})
+	assertQueryPositions(t,
+		"[a]\nb = 1\n[a.c]\nd = 2",
+		"$.a.c..leaves()",
+		[]interface{}{
+			queryTestNode{int64(2), toml.Position{4, 1}},
+		})
+	assertQueryPositions(t,
+		"[a]\nb = 1\n[a.c]\nd = 2",
+		"$..leaves()^",
+		[]interface{}{
+			queryTestNode{
+				map[string]interface{}{
+					"b": int64(1),
+					"c": map[string]interface{}{"d": int64(2)},
+				}, toml.Position{1, 1},
+			},
+			queryTestNode{
+				map[string]interface{}{"d": int64(2)},
+				toml.Position{3, 1},
+			},
+		})
+}
+
+func TestCompileDisallowRecursive(t *testing.T) {
+	for _, path := range []string{"$..a", "$.a..*", "$..leaves()", "$.a[0]..['b']"} {
+		if _, err := Compile(path); err != nil {
+			t.Errorf("%s: unexpected error %v", path, err)
+		}
+		_, err := CompileWithOptions(path, CompileOptions{DisallowRecursive: true})
+		pathErr, ok := err.(*PathError)
+		if !ok || pathErr.Msg != "recursive descent is not allowed" {
+			t.Errorf("%s: expected a recursive descent error, got %v", path, err)
+		}
+	}
+	if _, err := CompileWithOptions("$.a[0].b[?(@.c)]", CompileOptions{DisallowRecursive: true}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	_, err := CompileWithOptions("$.a..b", CompileOptions{DisallowRecursive: true})
+	if err == nil || err.(*PathError).Position != (toml.Position{1, 4}) {
+		t.Errorf("expected an error at (1, 4), got %v", err)
+	}
+}
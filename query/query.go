@@ -1,6 +1,10 @@
 package query
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/pelletier/go-toml"
@@ -21,12 +25,15 @@ type NodeFilterFn func(node interface{}) bool
 type Result struct {
 	items     []interface{}
 	positions []toml.Position
+	locations []nodeLocation
+	err       error
 }
 
-// appends a value/position pair to the result set.
-func (r *Result) appendResult(node interface{}, pos toml.Position) {
+// appends a value/position/location triplet to the result set.
+func (r *Result) appendResult(node interface{}, pos toml.Position, loc nodeLocation) {
 	r.items = append(r.items, node)
 	r.positions = append(r.positions, pos)
+	r.locations = append(r.locations, loc)
 }
 
 // Values is a set of values within a Result.  The order of values is not
@@ -42,11 +49,81 @@ func (r Result) Positions() []toml.Position {
 	return r.positions
 }
 
+// Err returns the error which stopped the query, if any, such as a strlen
+// filter applied to a value which is not a string. The values matched before
+// the error are still part of the Result.
+func (r Result) Err() error {
+	return r.err
+}
+
+// location of a node within its parent, used to modify matched nodes
+type nodeLocation struct {
+	parent interface{} // *toml.Tree, []*toml.Tree or []interface{}; nil for the root
+	key    string      // key of the node when parent is a *toml.Tree
+	index  int         // index of the node when parent is an array
+
+	// location and position of parent itself, for the parent operator
+	up         *nodeLocation
+	upPosition toml.Position
+}
+
+// replaces the node at this location with value
+func (loc nodeLocation) set(value interface{}) error {
+	switch parent := loc.parent.(type) {
+	case *toml.Tree:
+		parent.UpdatePath([]string{loc.key}, value)
+	case []interface{}:
+		parent[loc.index] = value
+	case []*toml.Tree:
+		tree, ok := value.(*toml.Tree)
+		if !ok {
+			return fmt.Errorf("cannot replace a table of an array of tables with %T", value)
+		}
+		parent[loc.index] = tree
+	default:
+		return errors.New("cannot replace the root of the tree")
+	}
+	return nil
+}
+
 // runtime context for executing query paths
 type queryContext struct {
 	result       *Result
 	filters      *map[string]NodeFilterFn
 	lastPosition toml.Position
+	lastLocation nodeLocation
+
+	caseInsensitive bool
+	first           bool            // stop after the first result
+	done            bool            // set once the query can stop matching
+	ctx             context.Context // stops the matching once done, if set
+	err             error           // why the matching was cut short, if it was
+}
+
+// stops the query with err, unless it already stopped with another error
+func (ctx *queryContext) fail(err error) {
+	if ctx.err == nil {
+		ctx.err = err
+	}
+	ctx.done = true
+}
+
+// reports whether the query should stop matching, because it is done or its
+// context is canceled
+func (ctx *queryContext) stopped() bool {
+	if !ctx.done && ctx.ctx != nil && ctx.ctx.Err() != nil {
+		ctx.done = true
+		ctx.err = ctx.ctx.Err()
+	}
+	return ctx.done
+}
+
+// returns the location of a child of the node the context is currently at,
+// to be completed with the key or index of the child. It must be called before
+// the context moves to any of the children.
+func (ctx *queryContext) childLocation(parent interface{}) nodeLocation {
+	up := ctx.lastLocation
+	return nodeLocation{parent: parent, up: &up, upPosition: ctx.lastPosition}
 }
 
 // generic path functor interface
@@ -63,6 +140,8 @@ type Query struct {
 	root    pathFn
 	tail    pathFn
 	filters *map[string]NodeFilterFn
+
+	caseInsensitive bool
 }
 
 func newQuery() *Query {
@@ -85,36 +164,193 @@ func (q *Query) appendPath(next pathFn) {
 
 // Compile compiles a TOML path expression. The returned Query can be used
 // to match elements within a Tree and its descendants. See Execute.
+//
+// A malformed path expression results in a *PathError.
 func Compile(path string) (*Query, error) {
-	return parseQuery(lexQuery(path))
+	return parseQuery(path, CompileOptions{})
+}
+
+// CompileOptions restrict the path expressions accepted by
+// CompileWithOptions.
+type CompileOptions struct {
+	// DisallowRecursive rejects the recursive descent operator '..', whose
+	// cost grows with the size of the whole tree. This makes it safer to
+	// compile path expressions from untrusted sources.
+	DisallowRecursive bool
+}
+
+// CompileWithOptions compiles a TOML path expression like Compile, rejecting
+// the constructs disallowed by opts with a *PathError.
+func CompileWithOptions(path string, opts CompileOptions) (*Query, error) {
+	return parseQuery(path, opts)
 }
 
 // Execute executes a query against a Tree, and returns the result of the query.
+// If the query fails, the error is available with Result.Err.
 func (q *Query) Execute(tree *toml.Tree) *Result {
+	return q.execute(nil, tree, false)
+}
+
+// ExecuteContext executes a query against a Tree like Execute, but stops
+// traversing the tree once ctx is done. If the traversal is cut short, the
+// error of ctx is returned along with the values matched so far. Errors of
+// the query itself, as returned by Result.Err, are returned as well.
+func (q *Query) ExecuteContext(ctx context.Context, tree *toml.Tree) (*Result, error) {
+	result := q.execute(ctx, tree, false)
+	return result, result.err
+}
+
+// ExecuteTimeout executes a query against a Tree like ExecuteContext, with a
+// context whose deadline is d from now. If the traversal of the tree takes
+// longer, context.DeadlineExceeded is returned along with the values matched
+// so far.
+func (q *Query) ExecuteTimeout(tree *toml.Tree, d time.Duration) (*Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return q.ExecuteContext(ctx, tree)
+}
+
+// executes the query, stopping once cancel is done if it is not nil, or after
+// the first result if first is set. The error of the result is the one of
+// cancel if the traversal was cut short by it.
+func (q *Query) execute(cancel context.Context, tree *toml.Tree, first bool) *Result {
 	result := &Result{
 		items:     []interface{}{},
 		positions: []toml.Position{},
 	}
 	if q.root == nil {
-		result.appendResult(tree, tree.GetPosition(""))
-	} else {
-		ctx := &queryContext{
-			result:  result,
-			filters: q.filters,
-		}
-		ctx.lastPosition = tree.Position()
-		q.root.call(tree, ctx)
+		result.appendResult(tree, tree.GetPosition(""), nodeLocation{})
+		return result
 	}
+	ctx := &queryContext{
+		result:          result,
+		filters:         q.filters,
+		caseInsensitive: q.caseInsensitive,
+		first:           first,
+		ctx:             cancel,
+	}
+	ctx.lastPosition = tree.Position()
+	q.root.call(tree, ctx)
+	result.err = ctx.err
 	return result
 }
 
+// ExecuteUnique executes a query against a Tree like Execute, but returns
+// each matched node only once, such as when the paths of a union overlap.
+// Tables are the same node if they are the same *toml.Tree, and other values
+// if they are found at the same key or index of the same parent.
+func (q *Query) ExecuteUnique(tree *toml.Tree) *Result {
+	result := q.Execute(tree)
+	unique := &Result{
+		items:     []interface{}{},
+		positions: []toml.Position{},
+		err:       result.err,
+	}
+	seen := map[nodeIdentity]bool{}
+	for i, item := range result.items {
+		id := identityOf(item, result.locations[i])
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique.appendResult(item, result.positions[i], result.locations[i])
+	}
+	return unique
+}
+
+// identifies a matched node, by pointer for tables and by location otherwise
+type nodeIdentity struct {
+	tree   *toml.Tree
+	parent uintptr
+	key    string
+	index  int
+}
+
+func identityOf(node interface{}, loc nodeLocation) nodeIdentity {
+	if tree, ok := node.(*toml.Tree); ok {
+		return nodeIdentity{tree: tree}
+	}
+	id := nodeIdentity{key: loc.key, index: loc.index}
+	if loc.parent != nil {
+		id.parent = reflect.ValueOf(loc.parent).Pointer()
+	}
+	return id
+}
+
+// ExecuteFirst executes a query against a Tree, and returns the first value
+// matched. Matching stops as soon as a value is found, so that the rest of the
+// tree is not traversed. The boolean result is false if nothing matched, or if
+// the query failed before a match, as with Result.Err.
+//
+// As with Result.Values, which value is found first is not guaranteed to follow
+// document order.
+func (q *Query) ExecuteFirst(tree *toml.Tree) (interface{}, bool) {
+	result := q.execute(nil, tree, true)
+	if len(result.items) == 0 {
+		return nil, false
+	}
+	return result.items[0], true
+}
+
 // CompileAndExecute is a shorthand for Compile(path) followed by Execute(tree).
+// The error of the result, if any, is returned along with it.
 func CompileAndExecute(path string, tree *toml.Tree) (*Result, error) {
 	query, err := Compile(path)
 	if err != nil {
 		return nil, err
 	}
-	return query.Execute(tree), nil
+	result := query.Execute(tree)
+	return result, result.err
+}
+
+// Set replaces every node of tree matched by the query with value. Replaced
+// values keep the position and comment of the node they replace, so the rest
+// of the document is left untouched.
+//
+// value should be one of the types stored in a Tree (see Tree.ToMap), or a
+// *toml.Tree when replacing tables. An error is returned if a matched node
+// cannot be replaced, for example the root of the tree, or if the query fails,
+// in which case nothing is replaced.
+func (q *Query) Set(tree *toml.Tree, value interface{}) error {
+	result := q.Execute(tree)
+	if result.err != nil {
+		return result.err
+	}
+	for _, loc := range result.locations {
+		if err := loc.set(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Transform replaces every node of tree matched by the query with the result
+// of fn called with the node, and returns the number of nodes replaced. As with
+// Set, replaced values keep the position and comment of the node they replace.
+//
+// All the nodes are matched before any is replaced. When a matched node is
+// nested in another, the order in which they are replaced is not specified.
+// Transform stops at the first node which cannot be replaced, and returns an
+// error along with the number of nodes replaced so far. Nothing is replaced if
+// the query fails.
+func (q *Query) Transform(tree *toml.Tree, fn func(interface{}) interface{}) (int, error) {
+	result := q.Execute(tree)
+	if result.err != nil {
+		return 0, result.err
+	}
+	for i, loc := range result.locations {
+		if err := loc.set(fn(result.items[i])); err != nil {
+			return i, err
+		}
+	}
+	return len(result.locations), nil
+}
+
+// SetCaseInsensitive sets whether key names of the query match the keys of
+// the document regardless of their case. TOML keys are case-sensitive, so
+// this is disabled by default.
+func (q *Query) SetCaseInsensitive(v bool) {
+	q.caseInsensitive = v
 }
 
 // SetFilter sets a user-defined filter function.  These may be used inside
@@ -1,8 +1,10 @@
 package query
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/pelletier/go-toml"
 )
@@ -155,3 +157,264 @@ func TestTomlQuery(t *testing.T) {
 		t.Errorf("Expected 'b' with a value 2: %v", tt.Get("b"))
 	}
 }
+
+func TestQueryTreeFromMap(t *testing.T) {
+	source, err := toml.Load(`
+[[servers]]
+name = "alpha"
+ports = [[80, 443], [8080]]
+[[servers]]
+name = "beta"
+[owner]
+name = "Tom"
+`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	tree, err := toml.TreeFromMap(source.ToMap())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	result, err := CompileAndExecute("$.servers.name", tree)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertArrayContainsInAnyOrder(t, result.Values(), "alpha", "beta")
+
+	result, err = CompileAndExecute("$.owner.name", tree)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertArrayContainsInAnyOrder(t, result.Values(), "Tom")
+}
+
+func TestQuerySet(t *testing.T) {
+	tree, err := toml.Load(`
+[[servers]]
+name = "alpha"
+port = 80
+[[servers]]
+name = "beta"
+port = 81
+`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	servers := tree.Get("servers").([]*toml.Tree)
+	servers[0].SetWithComment("name", "primary server", false, "alpha")
+	servers[1].SetWithComment("port", "backup port", false, int64(81))
+	pos := servers[0].GetPosition("port")
+
+	q, err := Compile("$.servers[0].port")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if err := q.Set(tree, int64(8080)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if servers[0].Get("port") != int64(8080) {
+		t.Errorf("expected port to be updated, got %v", servers[0].Get("port"))
+	}
+	if servers[0].GetPosition("port") != pos {
+		t.Errorf("expected position %v to be kept, got %v", pos, servers[0].GetPosition("port"))
+	}
+	expected := `
+[[servers]]
+
+  # primary server
+  name = "alpha"
+  port = 8080
+
+[[servers]]
+  name = "beta"
+
+  # backup port
+  port = 81
+`
+	if tree.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, tree.String())
+	}
+}
+
+func TestQuerySetRoot(t *testing.T) {
+	tree, _ := toml.Load("a = 1")
+	q, _ := Compile("$")
+	if err := q.Set(tree, int64(2)); err == nil {
+		t.Error("expected an error when replacing the root")
+	}
+}
+
+func TestQuerySetArrayElement(t *testing.T) {
+	tree, _ := toml.Load("a = [1, 2, 3]")
+	q, _ := Compile("$.a[1]")
+	if err := q.Set(tree, int64(42)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertValue(t, tree.Get("a"), []interface{}{int64(1), int64(42), int64(3)})
+}
+
+func TestQueryTransform(t *testing.T) {
+	tree, err := toml.Load(`
+name = "doc"
+count = 1
+[server]
+port = 80
+ratio = 1.5
+ports = [8000, 8001]
+`)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	q, err := Compile("$..[?(int)]")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	count, err := q.Transform(tree, func(node interface{}) interface{} {
+		return node.(int64) * 2
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if count != 4 {
+		t.Errorf("expected 4 transformed nodes, got %d", count)
+	}
+	assertValue(t, tree.ToMap(), map[string]interface{}{
+		"name":  "doc",
+		"count": int64(2),
+		"server": map[string]interface{}{
+			"port":  int64(160),
+			"ratio": 1.5,
+			"ports": []interface{}{int64(16000), int64(16002)},
+		},
+	})
+
+	root, _ := Compile("$")
+	if count, err := root.Transform(tree, func(node interface{}) interface{} { return node }); err == nil || count != 0 {
+		t.Errorf("expected an error when replacing the root, got %d, %v", count, err)
+	}
+}
+
+func TestQueryCaseInsensitive(t *testing.T) {
+	tree, _ := toml.Load(`
+[server]
+host = "localhost"
+[Server2]
+HOST = "example.com"
+`)
+	q, err := Compile("$.Server.Host")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if values := q.Execute(tree).Values(); len(values) != 0 {
+		t.Errorf("keys should be case-sensitive by default, got %v", values)
+	}
+
+	q.SetCaseInsensitive(true)
+	assertArrayContainsInAnyOrder(t, q.Execute(tree).Values(), "localhost")
+
+	q, _ = Compile("$.*.host")
+	q.SetCaseInsensitive(true)
+	assertArrayContainsInAnyOrder(t, q.Execute(tree).Values(), "localhost", "example.com")
+}
+
+func TestQueryExecuteFirst(t *testing.T) {
+	tree, _ := toml.Load("[a]\nport = 1\n[a.b]\nport = 2\n[a.b.c]\nport = 3\n[d]\nport = 4")
+
+	q, _ := Compile("$..[?(counted)]")
+	calls := 0
+	q.SetFilter("counted", func(node interface{}) bool {
+		calls++
+		return true
+	})
+
+	q.Execute(tree)
+	allCalls := calls
+
+	calls = 0
+	value, ok := q.ExecuteFirst(tree)
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if value != tree.Get("a") && value != tree.Get("d") {
+		t.Errorf("expected the first match to be a top-level table, got %v", value)
+	}
+	if calls >= allCalls {
+		t.Errorf("expected ExecuteFirst to stop early, filter called %d times (%d for Execute)", calls, allCalls)
+	}
+
+	q, _ = Compile("$.a.b.port")
+	if value, ok := q.ExecuteFirst(tree); !ok || value != int64(2) {
+		t.Errorf("expected port 2, got %v", value)
+	}
+
+	q, _ = Compile("$..missing")
+	if value, ok := q.ExecuteFirst(tree); ok || value != nil {
+		t.Errorf("expected no match, got %v", value)
+	}
+}
+
+func TestQueryExecuteTimeout(t *testing.T) {
+	tree, _ := toml.Load("[a]\nport = 1\n[a.b]\nport = 2\n[a.b.c]\nport = 3\n[d]\nport = 4")
+
+	q, _ := Compile("$..[?(slow)]")
+	calls := 0
+	q.SetFilter("slow", func(node interface{}) bool {
+		calls++
+		time.Sleep(20 * time.Millisecond)
+		return true
+	})
+
+	result, err := q.ExecuteTimeout(tree, 30*time.Millisecond)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+	if calls > 2 {
+		t.Errorf("expected the traversal to stop at the deadline, filter called %d times", calls)
+	}
+	if len(result.Values()) > calls {
+		t.Errorf("expected at most %d values, got %v", calls, result.Values())
+	}
+
+	calls = 0
+	result, err = q.ExecuteTimeout(tree, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Values()) != len(q.Execute(tree).Values()) {
+		t.Errorf("expected all the values, got %v", result.Values())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err = q.ExecuteContext(ctx, tree)
+	if err != context.Canceled || len(result.Values()) != 0 {
+		t.Errorf("expected a canceled query without values, got %v and %v", result.Values(), err)
+	}
+
+	// a traversal which completes is not reported as canceled
+	q, _ = Compile("$.a.port")
+	result, err = q.ExecuteContext(ctx, tree)
+	if err != nil || len(result.Values()) != 1 {
+		t.Errorf("expected a complete query without error, got %v and %v", result.Values(), err)
+	}
+}
+
+func TestQueryExecuteUnique(t *testing.T) {
+	tree, _ := toml.Load("[server]\nhost = \"localhost\"\nport = 80\n[client]\nport = 80\n")
+
+	q, _ := Compile("$.server['host','port','host']")
+	assertArrayContainsInAnyOrder(t, q.Execute(tree).Values(), "localhost", int64(80), "localhost")
+	assertArrayContainsInAnyOrder(t, q.ExecuteUnique(tree).Values(), "localhost", int64(80))
+
+	// equal values at different locations are different nodes
+	q, _ = Compile("$..port")
+	assertArrayContainsInAnyOrder(t, q.ExecuteUnique(tree).Values(), int64(80), int64(80))
+
+	q, _ = Compile("$['server','client','server']")
+	result := q.ExecuteUnique(tree)
+	assertArrayContainsInAnyOrder(t, result.Values(), tree.Get("server"), tree.Get("client"))
+	if len(result.Positions()) != 2 {
+		t.Errorf("expected a position for each value, got %v", result.Positions())
+	}
+}
@@ -32,6 +32,9 @@ const (
 	tokenQuestion
 	tokenDot
 	tokenDotDot
+	tokenAt
+	tokenOperator
+	tokenCaret
 )
 
 var tokenTypeNames = []string{
@@ -52,6 +55,9 @@ var tokenTypeNames = []string{
 	"?",
 	".",
 	"..",
+	"@",
+	"Operator",
+	"^",
 }
 
 type token struct {
@@ -0,0 +1,122 @@
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ResolveReferences substitutes the references to other values of a decoded
+// document, such as the result of Tree.ToMap or of decoding into a
+// map[string]interface{}, in the strings of the document. A reference is
+// written ${key}, where key is the dotted path of a string, integer, float or
+// boolean value from the root of the document, e.g. ${server.host}. Key
+// segments which are not valid bare keys must be quoted, as done by
+// CanonicalKey. Referenced strings are resolved first, so references may be
+// chained, but a reference cycle is an error.
+//
+// Strings are replaced in tree, including the strings of arrays and of arrays
+// of tables. Paths only go through tables, so the values of arrays cannot be
+// referenced.
+func ResolveReferences(tree map[string]interface{}) error {
+	r := referenceResolver{tree: tree, resolving: map[string]bool{}}
+	return r.resolveTable(tree, nil)
+}
+
+type referenceResolver struct {
+	tree      map[string]interface{}
+	resolving map[string]bool // canonical keys of the strings being resolved
+}
+
+func (r *referenceResolver) resolveTable(table map[string]interface{}, path []string) error {
+	for k, v := range table {
+		resolved, err := r.resolveValue(v, append(path[:len(path):len(path)], k))
+		if err != nil {
+			return err
+		}
+		table[k] = resolved
+	}
+	return nil
+}
+
+func (r *referenceResolver) resolveValue(value interface{}, path []string) (interface{}, error) {
+	switch node := value.(type) {
+	case string:
+		return r.resolveString(node, path)
+	case map[string]interface{}:
+		return node, r.resolveTable(node, path)
+	case []map[string]interface{}:
+		for _, table := range node {
+			if err := r.resolveTable(table, path); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range node {
+			resolved, err := r.resolveValue(item, path)
+			if err != nil {
+				return nil, err
+			}
+			node[i] = resolved
+		}
+	}
+	return value, nil
+}
+
+// Substitutes the references of s, the value found at path
+func (r *referenceResolver) resolveString(s string, path []string) (string, error) {
+	var result bytes.Buffer
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			result.WriteString(s)
+			return result.String(), nil
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("%s: unclosed reference %s", CanonicalKey(path), s[start:])
+		}
+		value, err := r.resolveKey(s[start+2:start+end], path)
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(s[:start])
+		result.WriteString(value)
+		s = s[start+end+1:]
+	}
+}
+
+// Returns the string form of the value referenced by key, resolving it first
+// if it is a string
+func (r *referenceResolver) resolveKey(key string, from []string) (string, error) {
+	keys, err := parseKey(key)
+	if err != nil {
+		return "", fmt.Errorf("%s: invalid reference ${%s}: %s", CanonicalKey(from), key, err)
+	}
+	value, ok := lookupPath(r.tree, keys)
+	if !ok {
+		return "", fmt.Errorf("%s: reference to undefined key %s", CanonicalKey(from), key)
+	}
+	switch schemaType(value) {
+	case "integer", "float", "boolean":
+		return fmt.Sprint(value), nil
+	case "string":
+	default:
+		return "", fmt.Errorf("%s: cannot substitute %s, which is not a string, number or boolean",
+			CanonicalKey(from), key)
+	}
+
+	name := CanonicalKey(keys)
+	if r.resolving[name] {
+		return "", fmt.Errorf("%s: cyclic reference to %s", CanonicalKey(from), name)
+	}
+	r.resolving[name] = true
+	defer delete(r.resolving, name)
+	resolved, err := r.resolveString(value.(string), keys)
+	if err != nil {
+		return "", err
+	}
+	parent, _ := lookupPath(r.tree, keys[:len(keys)-1])
+	parent.(map[string]interface{})[keys[len(keys)-1]] = resolved
+	return resolved, nil
+}
@@ -0,0 +1,78 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func resolveDocument(t *testing.T, doc string) (map[string]interface{}, error) {
+	tree, err := Load(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := tree.ToMap()
+	return m, ResolveReferences(m)
+}
+
+func TestResolveReferences(t *testing.T) {
+	m, err := resolveDocument(t, `
+root = "/opt"
+logs = "${paths.base}/logs"
+url = "http://${server.host}:${server.port}/"
+home = "$HOME"
+cert = '${server."tls.cert"}'
+[paths]
+base = "${root}/app"
+cache = "${logs}/cache"
+[server]
+host = "localhost"
+port = 8080
+"tls.cert" = "cert.pem"
+[[workers]]
+dirs = ["${paths.base}/w1", "${paths.base}/w2"]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"root": "/opt",
+		"logs": "/opt/app/logs",
+		"url":  "http://localhost:8080/",
+		"home": "$HOME",
+		"cert": "cert.pem",
+		"paths": map[string]interface{}{
+			"base":  "/opt/app",
+			"cache": "/opt/app/logs/cache",
+		},
+		"server": map[string]interface{}{
+			"host":     "localhost",
+			"port":     int64(8080),
+			"tls.cert": "cert.pem",
+		},
+		"workers": []interface{}{
+			map[string]interface{}{
+				"dirs": []interface{}{"/opt/app/w1", "/opt/app/w2"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Bad resolution: expected\n%v\ngot\n%v", expected, m)
+	}
+}
+
+func TestResolveReferencesErrors(t *testing.T) {
+	for doc, expected := range map[string]string{
+		"a = \"${b}\"\nb = \"${a}\"": "cyclic reference to",
+		"a = \"${a}\"":               "a: cyclic reference to a",
+		"a = \"${missing}\"":         "a: reference to undefined key missing",
+		"a = \"${t}\"\n[t]\nb = 1":   "a: cannot substitute t, which is not a string, number or boolean",
+		"a = \"x ${b\"\nb = 1":       "a: unclosed reference ${b",
+		"a = \"${b.}\"\nb = 1":       "a: invalid reference ${b.}",
+	} {
+		_, err := resolveDocument(t, doc)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected an error containing %q, got %v", doc, expected, err)
+		}
+	}
+}
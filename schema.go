@@ -0,0 +1,170 @@
+package toml
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Schema describes the expected content of a document, as rules keyed by the
+// dotted path of the value they apply to (e.g. "server.port"). Key segments
+// which are not valid bare keys must be quoted, as done by CanonicalKey.
+// Paths only go through tables, not arrays of tables.
+type Schema map[string]SchemaRule
+
+// SchemaRule constrains the value at a path of a document.
+type SchemaRule struct {
+	// Required reports a missing value as an error.
+	Required bool
+	// Type is the expected TOML type of the value: "string", "integer",
+	// "float", "boolean", "datetime", "array" or "table". Any type is
+	// accepted if empty.
+	Type string
+	// Enum lists the allowed values, if not empty. Integers and floats of
+	// any Go type are compared by value.
+	Enum []interface{}
+}
+
+// SchemaError is a violation of a schema rule, returned by ValidateSchema.
+type SchemaError struct {
+	Path string // path of the rule
+	Msg  string
+}
+
+func (e *SchemaError) Error() string {
+	return e.Path + ": " + e.Msg
+}
+
+// ValidateSchema checks a decoded document, such as the result of Tree.ToMap
+// or of decoding into a map[string]interface{}, against schema. It returns
+// a *SchemaError for every violated rule, ordered by path, or nil if the
+// document is valid.
+func ValidateSchema(tree map[string]interface{}, schema Schema) []error {
+	paths := make([]string, 0, len(schema))
+	for path := range schema {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var errs []error
+	for _, path := range paths {
+		rule := schema[path]
+		keys, err := parseKey(path)
+		if err != nil {
+			errs = append(errs, &SchemaError{path, fmt.Sprintf("invalid path: %s", err)})
+			continue
+		}
+		value, ok := lookupPath(tree, keys)
+		if !ok {
+			if rule.Required {
+				errs = append(errs, &SchemaError{path, "required key is missing"})
+			}
+			continue
+		}
+		if rule.Type != "" {
+			if actual := schemaType(value); actual != rule.Type {
+				errs = append(errs, &SchemaError{path, fmt.Sprintf("expected %s, got %s", rule.Type, actual)})
+				continue
+			}
+		}
+		if len(rule.Enum) > 0 && !enumContains(rule.Enum, value) {
+			errs = append(errs, &SchemaError{path, fmt.Sprintf("%v is not one of %v", value, rule.Enum)})
+		}
+	}
+	return errs
+}
+
+// Returns the value at the given path of nested maps
+func lookupPath(tree map[string]interface{}, keys []string) (interface{}, bool) {
+	var value interface{} = tree
+	for _, key := range keys {
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = table[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Returns the name of the TOML type of a decoded value
+func schemaType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, Integer:
+		return "integer"
+	case float32, float64:
+		return "float"
+	case bool:
+		return "boolean"
+	case time.Time, LocalDate, LocalTime, LocalDateTime:
+		return "datetime"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "table"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func enumContains(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if enumEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compares values, converting numbers to a common type
+func enumEqual(a, b interface{}) bool {
+	if ai, ok := numberAsInt(a); ok {
+		if bi, ok := numberAsInt(b); ok {
+			return ai == bi
+		}
+	}
+	if af, ok := numberAsFloat(a); ok {
+		bf, ok := numberAsFloat(b)
+		return ok && af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func numberAsInt(value interface{}) (int64, bool) {
+	if i, ok := value.(Integer); ok {
+		return i.Value, true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), v.Uint() <= math.MaxInt64
+	default:
+		return 0, false
+	}
+}
+
+func numberAsFloat(value interface{}) (float64, bool) {
+	if i, ok := value.(Integer); ok {
+		value = i.Value
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,60 @@
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testSchema = Schema{
+	"title":             {Required: true, Type: "string"},
+	"server.host":       {Required: true, Type: "string"},
+	"server.port":       {Type: "integer"},
+	"server.mode":       {Type: "string", Enum: []interface{}{"dev", "prod"}},
+	"server.level":      {Enum: []interface{}{1, 2, 3.5}},
+	`server."tls.cert"`: {Type: "string"},
+	"owner":             {Type: "table"},
+}
+
+func TestValidateSchema(t *testing.T) {
+	tree, err := Load(`title = "valid"
+[server]
+host = "localhost"
+port = 8080
+mode = "prod"
+level = 2
+"tls.cert" = "/etc/cert.pem"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := ValidateSchema(tree.ToMap(), testSchema); errs != nil {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+}
+
+func TestValidateSchemaErrors(t *testing.T) {
+	tree, err := Load(`owner = "tom"
+[server]
+port = "8080"
+mode = "test"
+level = 4
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := ValidateSchema(tree.ToMap(), testSchema)
+	expected := []error{
+		&SchemaError{"owner", "expected table, got string"},
+		&SchemaError{"server.host", "required key is missing"},
+		&SchemaError{"server.level", "4 is not one of [1 2 3.5]"},
+		&SchemaError{"server.mode", "test is not one of [dev prod]"},
+		&SchemaError{"server.port", "expected integer, got string"},
+		&SchemaError{"title", "required key is missing"},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("expected errors %v, got %v", expected, errs)
+	}
+	if errs[0].Error() != "owner: expected table, got string" {
+		t.Errorf("bad error message: %s", errs[0])
+	}
+}
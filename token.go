@@ -35,6 +35,9 @@ const (
 	tokenDoubleLeftBracket
 	tokenDoubleRightBracket
 	tokenDate
+	tokenLocalDate
+	tokenLocalTime
+	tokenLocalDateTime
 	tokenKeyGroup
 	tokenKeyGroupArray
 	tokenComma
@@ -69,6 +72,9 @@ var tokenTypeNames = []string{
 	"]]",
 	"[[",
 	"Date",
+	"LocalDate",
+	"LocalTime",
+	"LocalDateTime",
 	"KeyGroup",
 	"KeyGroupArray",
 	",",
@@ -114,6 +120,10 @@ func (t token) String() string {
 	return fmt.Sprintf("%q", t.val)
 }
 
+func isDateTimeChar(r rune) bool {
+	return isDigit(r) || r == '-' || r == '+' || r == ':' || r == '.' || r == 'T' || r == 't' || r == 'Z' || r == 'z' || r == ' '
+}
+
 func isSpace(r rune) bool {
 	return r == ' ' || r == '\t'
 }
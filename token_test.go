@@ -26,6 +26,9 @@ func TestTokenStringer(t *testing.T) {
 		{tokenDoubleLeftBracket, "]]"},
 		{tokenDoubleRightBracket, "[["},
 		{tokenDate, "Date"},
+		{tokenLocalDate, "LocalDate"},
+		{tokenLocalTime, "LocalTime"},
+		{tokenLocalDateTime, "LocalDateTime"},
 		{tokenKeyGroup, "KeyGroup"},
 		{tokenKeyGroupArray, "KeyGroupArray"},
 		{tokenComma, ","},
@@ -7,15 +7,18 @@ import (
 	"io/ioutil"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 )
 
 type tomlValue struct {
-	value     interface{} // string, int64, uint64, float64, bool, time.Time, [] of any of this list
+	value     interface{} // string, int64, uint64, float64, bool, time.Time, LocalDate, LocalTime, LocalDateTime, [] of any of this list
 	comment   string
 	commented bool
 	multiline bool
 	position  Position
+	span      Span
+	comments  *keyComments // comments of the source document, if kept
 }
 
 // Tree is the result of the parsing of a TOML file.
@@ -24,6 +27,14 @@ type Tree struct {
 	comment   string
 	commented bool
 	position  Position
+	span      Span         // source span of inline tables
+	comments  *keyComments // comments of the table header, if kept
+}
+
+// comments of the source document associated with a key or a table header
+type keyComments struct {
+	leading  []string // block of comment lines directly above
+	trailing string   // comment following on the same line
 }
 
 func newTree() *Tree {
@@ -38,6 +49,10 @@ func newTreeWithPosition(pos Position) *Tree {
 }
 
 // TreeFromMap initializes a new Tree object using the given map.
+//
+// Values may be any type produced by Tree.ToMap, including nested arrays and
+// arrays of maps (converted to arrays of tables). *Tree and []*Tree values are
+// inserted as-is.
 func TreeFromMap(m map[string]interface{}) (*Tree, error) {
 	result, err := toTree(m)
 	if err != nil {
@@ -171,6 +186,108 @@ func (t *Tree) GetPositionPath(keys []string) Position {
 	}
 }
 
+// collectSpans records in result the source span of every value of the tree
+// read from a document, keyed by its dotted path prefixed with prefix.
+// Tables of arrays of tables are keyed by their index, as in "name[0]".
+func (t *Tree) collectSpans(result map[string]Span, prefix string) {
+	for k, v := range t.values {
+		key := prefix + quoteKeyIfNeeded(k)
+		switch node := v.(type) {
+		case *tomlValue:
+			if node.span != (Span{}) {
+				result[key] = node.span
+			}
+		case *Tree:
+			if node.span != (Span{}) {
+				result[key] = node.span
+			}
+			node.collectSpans(result, key+".")
+		case []*Tree:
+			for i, item := range node {
+				item.collectSpans(result, fmt.Sprintf("%s[%d].", key, i))
+			}
+		}
+	}
+}
+
+// collectComments records in result the comments kept for every value and
+// table of the tree, keyed like collectSpans.
+func (t *Tree) collectComments(result map[string]*keyComments, prefix string) {
+	for k, v := range t.values {
+		key := prefix + quoteKeyIfNeeded(k)
+		switch node := v.(type) {
+		case *tomlValue:
+			if node.comments != nil {
+				result[key] = node.comments
+			}
+		case *Tree:
+			if node.comments != nil {
+				result[key] = node.comments
+			}
+			node.collectComments(result, key+".")
+		case []*Tree:
+			for i, item := range node {
+				itemKey := fmt.Sprintf("%s[%d]", key, i)
+				if item.comments != nil {
+					result[itemKey] = item.comments
+				}
+				item.collectComments(result, itemKey+".")
+			}
+		}
+	}
+}
+
+// Paths returns the dotted path of every value and table of the tree,
+// including intermediate tables, ordered by their position in the source
+// document. Tables of arrays of tables are listed by their index, as in
+// "name[0]", followed by their own keys. Segments which are not valid bare
+// keys are quoted. Values which were not read from a document come first.
+func (t *Tree) Paths() []string {
+	var nodes []pathNode
+	t.collectPaths(&nodes, "")
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.position != b.position {
+			return a.position.Line < b.position.Line ||
+				a.position.Line == b.position.Line && a.position.Col < b.position.Col
+		}
+		// implicit tables share the position of the key defining them
+		if len(a.path) != len(b.path) {
+			return len(a.path) < len(b.path)
+		}
+		return a.path < b.path
+	})
+	paths := make([]string, len(nodes))
+	for i, node := range nodes {
+		paths[i] = node.path
+	}
+	return paths
+}
+
+type pathNode struct {
+	path     string
+	position Position
+}
+
+func (t *Tree) collectPaths(result *[]pathNode, prefix string) {
+	for k, v := range t.values {
+		key := prefix + quoteKeyIfNeeded(k)
+		switch node := v.(type) {
+		case *tomlValue:
+			*result = append(*result, pathNode{key, node.position})
+		case *Tree:
+			*result = append(*result, pathNode{key, node.position})
+			node.collectPaths(result, key+".")
+		case []*Tree:
+			for i, item := range node {
+				itemKey := fmt.Sprintf("%s[%d]", key, i)
+				*result = append(*result, pathNode{itemKey, item.position})
+				item.collectPaths(result, itemKey+".")
+			}
+		}
+	}
+}
+
 // GetDefault works like Get but with a default value
 func (t *Tree) GetDefault(key string, def interface{}) interface{} {
 	val := t.Get(key)
@@ -239,6 +356,89 @@ func (t *Tree) SetPathWithOptions(keys []string, opts SetOptions, value interfac
 	subtree.values[keys[len(keys)-1]] = toInsert
 }
 
+// UpdatePath replaces the value at the given path, keeping the position and
+// formatting options (comment, commented, multiline) of the value it
+// replaces. If the path does not exist yet, UpdatePath behaves like SetPath.
+func (t *Tree) UpdatePath(keys []string, value interface{}) {
+	var parent *Tree
+	switch node := t.GetPath(keys[:len(keys)-1]).(type) {
+	case *Tree:
+		parent = node
+	case []*Tree:
+		if len(node) > 0 {
+			parent = node[len(node)-1]
+		}
+	}
+	if parent != nil {
+		key := keys[len(keys)-1]
+		switch old := parent.values[key].(type) {
+		case *tomlValue:
+			switch value.(type) {
+			case *Tree, []*Tree:
+			default:
+				old.value = value
+				return
+			}
+		case *Tree:
+			if tree, ok := value.(*Tree); ok {
+				tree.comment = old.comment
+				tree.commented = old.commented
+				tree.position = old.position
+				parent.values[key] = tree
+				return
+			}
+		}
+	}
+	t.SetPath(keys, value)
+}
+
+// Merge deep-merges value into the table at key, creating the table if it
+// does not exist. An empty key merges into t itself. Tables present on both
+// sides are merged recursively, and any other value replaces the existing one
+// as with UpdatePath, keeping its comment. Keys of the table absent from value
+// are left untouched.
+func (t *Tree) Merge(key string, value map[string]interface{}) error {
+	converted, err := toTree(value)
+	if err != nil {
+		return err
+	}
+	src := converted.(*Tree)
+	if key == "" {
+		t.mergeTree(src)
+		return nil
+	}
+	keys, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	switch node := t.GetPath(keys).(type) {
+	case *Tree:
+		node.mergeTree(src)
+	case nil:
+		t.SetPath(keys, src)
+	default:
+		return fmt.Errorf("cannot merge into %s: not a table", key)
+	}
+	return nil
+}
+
+func (t *Tree) mergeTree(src *Tree) {
+	for k, v := range src.values {
+		switch node := v.(type) {
+		case *Tree:
+			if dst, ok := t.values[k].(*Tree); ok {
+				dst.mergeTree(node)
+				continue
+			}
+			t.UpdatePath([]string{k}, node)
+		case *tomlValue:
+			t.UpdatePath([]string{k}, node.value)
+		default:
+			t.UpdatePath([]string{k}, node)
+		}
+	}
+}
+
 // Set an element in the tree.
 // Key is a dot-separated path (e.g. a.b.c).
 // Creates all necessary intermediate trees, if needed.
@@ -317,8 +517,8 @@ func (t *Tree) createSubTree(keys []string, pos Position) error {
 		case *Tree:
 			subtree = node
 		default:
-			return fmt.Errorf("unknown type for path %s (%s): %T (%#v)",
-				strings.Join(keys, "."), intermediateKey, nextTree, nextTree)
+			return fmt.Errorf("key %s is already defined as a value, cannot define table %s",
+				strings.Join(keys[:i+1], "."), strings.Join(keys, "."))
 		}
 	}
 	return nil
@@ -326,25 +526,40 @@ func (t *Tree) createSubTree(keys []string, pos Position) error {
 
 // LoadBytes creates a Tree from a []byte.
 func LoadBytes(b []byte) (tree *Tree, err error) {
+	return loadBytes(b, parserOptions{})
+}
+
+// Create a Tree from a []byte, parsing with the given options
+func loadBytes(b []byte, opts parserOptions) (tree *Tree, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if _, ok := r.(runtime.Error); ok {
 				panic(r)
 			}
+			if decodeErr, ok := r.(*DecodeError); ok {
+				err = decodeErr
+				return
+			}
 			err = errors.New(r.(string))
 		}
 	}()
 
+	flow, spans, comments := lexTomlWithSpans(stripBOM(b), opts.disallowTabs)
+	tree = parseToml(flow, spans, comments, opts)
+	return
+}
+
+// Returns the document without its byte order mark, if any, so that source
+// spans are relative to the returned slice
+func stripBOM(b []byte) []byte {
 	if len(b) >= 4 && (hasUTF32BigEndianBOM4(b) || hasUTF32LittleEndianBOM4(b)) {
-		b = b[4:]
+		return b[4:]
 	} else if len(b) >= 3 && hasUTF8BOM3(b) {
-		b = b[3:]
+		return b[3:]
 	} else if len(b) >= 2 && (hasUTF16BigEndianBOM2(b) || hasUTF16LittleEndianBOM2(b)) {
-		b = b[2:]
+		return b[2:]
 	}
-
-	tree = parseToml(lexToml(b))
-	return
+	return b
 }
 
 func hasUTF16BigEndianBOM2(b []byte) bool {
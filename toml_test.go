@@ -3,6 +3,7 @@
 package toml
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -178,3 +179,131 @@ func TestLoadBytesBOM(t *testing.T) {
 		}
 	}
 }
+
+func TestTomlUpdatePath(t *testing.T) {
+	tree, _ := Load(`
+		[test]
+		key = "value"
+	`)
+	tree.SetWithComment("test.key", "the key", false, "value")
+	pos := tree.GetPosition("test.key")
+
+	tree.UpdatePath([]string{"test", "key"}, "updated")
+	if tree.Get("test.key") != "updated" {
+		t.Errorf("UpdatePath should replace the value, got %v", tree.Get("test.key"))
+	}
+	if tree.GetPosition("test.key") != pos {
+		t.Errorf("UpdatePath should keep the position %v, got %v", pos, tree.GetPosition("test.key"))
+	}
+	expected := "\n[test]\n\n  # the key\n  key = \"updated\"\n"
+	if tree.String() != expected {
+		t.Errorf("UpdatePath should keep the comment: expected\n%s\ngot\n%s", expected, tree.String())
+	}
+
+	tree.UpdatePath([]string{"test", "other"}, int64(1))
+	if tree.Get("test.other") != int64(1) {
+		t.Errorf("UpdatePath should create missing values, got %v", tree.Get("test.other"))
+	}
+}
+
+func TestTomlMerge(t *testing.T) {
+	tree, _ := Load(`
+[server]
+host = "localhost"
+port = 80
+
+[server.tls]
+enabled = false
+`)
+	tree.SetWithComment("server.host", "the host name", false, "localhost")
+
+	err := tree.Merge("server", map[string]interface{}{
+		"port": 8080,
+		"tls": map[string]interface{}{
+			"cert": "server.pem",
+		},
+		"timeout": "5s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+[server]
+
+  # the host name
+  host = "localhost"
+  port = 8080
+  timeout = "5s"
+
+  [server.tls]
+    cert = "server.pem"
+    enabled = false
+`
+	if tree.String() != expected {
+		t.Errorf("Bad merge result: expected\n%s\ngot\n%s", expected, tree.String())
+	}
+
+	if err := tree.Merge("client.retry", map[string]interface{}{"count": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Get("client.retry.count") != int64(3) {
+		t.Errorf("Merge should create missing tables, got %v", tree.Get("client.retry.count"))
+	}
+
+	if err := tree.Merge("server.port", map[string]interface{}{"a": 1}); err == nil ||
+		err.Error() != "cannot merge into server.port: not a table" {
+		t.Errorf("expected an error merging into a value, got %v", err)
+	}
+
+	if err := tree.Merge(`"a.b".c`, map[string]interface{}{"d": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if tree.GetPath([]string{"a.b", "c", "d"}) != int64(1) {
+		t.Errorf("Merge should honor quoted keys, got %v", tree.ToMap())
+	}
+
+	if err := tree.Merge("a..b", map[string]interface{}{"d": 1}); err == nil {
+		t.Error("expected an error merging into an invalid key")
+	}
+}
+
+func TestTreePaths(t *testing.T) {
+	tree, err := Load(`title = "paths"
+owner.name = "tom"
+
+[servers.alpha]
+ip = "10.0.0.1"
+"dc.name" = "eqdc10"
+
+[[products]]
+name = "hammer"
+
+[[products]]
+name = "nail"
+sizes = [1, 2]
+
+[servers]
+enabled = true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"title",
+		"owner",
+		"owner.name",
+		"servers",
+		"servers.alpha",
+		"servers.alpha.ip",
+		`servers.alpha."dc.name"`,
+		"products[0]",
+		"products[0].name",
+		"products[1]",
+		"products[1].name",
+		"products[1].sizes",
+		"servers.enabled",
+	}
+	if paths := tree.Paths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected paths %v, got %v", expected, paths)
+	}
+}
@@ -12,7 +12,18 @@ import (
 	"github.com/davecgh/go-spew/spew"
 )
 
+// generated tests of invalid documents which are valid since TOML 1.0, and are
+// tested in parser_test.go instead
+var testgenObsoleteInvalid = map[string]bool{
+	"TestInvalidArrayMixedTypesArraysAndInts":  true,
+	"TestInvalidArrayMixedTypesIntsAndFloats":  true,
+	"TestInvalidArrayMixedTypesStringsAndInts": true,
+}
+
 func testgenInvalid(t *testing.T, input string) {
+	if testgenObsoleteInvalid[t.Name()] {
+		t.Skip("valid since TOML 1.0")
+	}
 	t.Logf("Input TOML:\n%s", input)
 	tree, err := Load(input)
 	if err != nil {
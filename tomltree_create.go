@@ -35,7 +35,7 @@ func typeFor(k reflect.Kind) reflect.Type {
 
 func simpleValueCoercion(object interface{}) (interface{}, error) {
 	switch original := object.(type) {
-	case string, bool, int64, uint64, float64, time.Time:
+	case string, bool, int64, uint64, float64, time.Time, Integer, LocalDate, LocalTime, LocalDateTime:
 		return original, nil
 	case int:
 		return int64(original), nil
@@ -75,7 +75,7 @@ func sliceToTree(object interface{}) (interface{}, error) {
 	if length > 0 {
 		insideType = reflect.ValueOf(value.Index(0).Interface()).Type()
 	}
-	if insideType.Kind() == reflect.Map {
+	if insideType.Kind() == reflect.Map || insideType == reflect.TypeOf(&Tree{}) {
 		// this is considered as an array of tables
 		tablesArray := make([]*Tree, 0, length)
 		for i := 0; i < length; i++ {
@@ -89,6 +89,23 @@ func sliceToTree(object interface{}) (interface{}, error) {
 		return tablesArray, nil
 	}
 
+	if insideType.Kind() == reflect.Slice || insideType.Kind() == reflect.Array {
+		// nested arrays are stored as []interface{} of their converted values
+		arrayValue := make([]interface{}, 0, length)
+		for i := 0; i < length; i++ {
+			inner, err := sliceToTree(value.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			tv, ok := inner.(*tomlValue)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert nested array of tables %T to Tree", value.Index(i).Interface())
+			}
+			arrayValue = append(arrayValue, tv.value)
+		}
+		return &tomlValue{value: arrayValue, position: Position{}}, nil
+	}
+
 	sliceType := typeFor(insideType.Kind())
 	if sliceType == nil {
 		sliceType = insideType
@@ -108,6 +125,12 @@ func sliceToTree(object interface{}) (interface{}, error) {
 }
 
 func toTree(object interface{}) (interface{}, error) {
+	switch node := object.(type) {
+	case *Tree, []*Tree:
+		// already in tree form, e.g. obtained from another Tree
+		return node, nil
+	}
+
 	value := reflect.ValueOf(object)
 
 	if value.Kind() == reflect.Map {
@@ -124,3 +124,47 @@ func TestRoundTripArrayOfTables(t *testing.T) {
 		t.Errorf("want:\n%s\ngot:\n%s", want, got)
 	}
 }
+
+func TestRoundTripNestedArrays(t *testing.T) {
+	orig := "a = [[1,2],[\"x\",\"y\"]]\n"
+	tree, err := Load(orig)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tree, err = TreeFromMap(tree.ToMap())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := orig
+	got := tree.String()
+
+	if got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestTreeCreateFromTrees(t *testing.T) {
+	source, err := Load("[table]\na = 1\n[[tables]]\nb = 2\n[[tables]]\nb = 3\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tree, err := TreeFromMap(map[string]interface{}{
+		"table":  source.Get("table"),
+		"tables": source.Get("tables"),
+		"mixed":  []interface{}{source.Get("table")},
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	validateTree(t, tree)
+	if tree.Get("table.a") != int64(1) {
+		t.Errorf("expected table.a to be 1, got %v", tree.Get("table.a"))
+	}
+	if trees, ok := tree.Get("tables").([]*Tree); !ok || len(trees) != 2 {
+		t.Errorf("expected tables to be an array of two tables, got %T", tree.Get("tables"))
+	}
+	if _, ok := tree.Get("mixed").([]*Tree); !ok {
+		t.Errorf("expected mixed to be an array of tables, got %T", tree.Get("mixed"))
+	}
+}
@@ -0,0 +1,53 @@
+package toml
+
+import (
+	"bytes"
+	"reflect"
+)
+
+// Patch returns a TOML document holding the keys of target which are absent
+// from base or whose value differs from it, as reported by DecodeDelta. Merging
+// the document into base, e.g. with Tree.Merge, yields target, except for the
+// keys of base absent from target, which a patch cannot remove.
+//
+// base and target are expected to use the types documented on Tree.ToMap.
+func Patch(base, target map[string]interface{}) ([]byte, error) {
+	tree, err := TreeFromMap(diffMaps(base, target))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := tree.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// diffMaps returns the entries of target which are absent from base or whose
+// value differs from it. Tables present in both maps are compared
+// recursively, so that only the differing keys of a table are returned.
+// Any other value, including arrays, is compared as a whole.
+//
+// Entries of base absent from target are not reported.
+func diffMaps(base, target map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for k, v := range target {
+		old, exists := base[k]
+		if !exists {
+			result[k] = v
+			continue
+		}
+		oldTable, oldIsTable := old.(map[string]interface{})
+		table, isTable := v.(map[string]interface{})
+		if oldIsTable && isTable {
+			if changed := diffMaps(oldTable, table); len(changed) > 0 {
+				result[k] = changed
+			}
+			continue
+		}
+		if !reflect.DeepEqual(old, v) {
+			result[k] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	base := map[string]interface{}{
+		"title": "patch",
+		"server": map[string]interface{}{
+			"host":  "localhost",
+			"port":  int64(80),
+			"ports": []interface{}{int64(80), int64(443)},
+		},
+	}
+	target := map[string]interface{}{
+		"title": "patch",
+		"server": map[string]interface{}{
+			"host":  "example.com",
+			"port":  int64(80),
+			"ports": []interface{}{int64(80), int64(443)},
+		},
+		"client": map[string]interface{}{
+			"timeout": int64(5),
+		},
+	}
+	patch, err := Patch(base, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+[client]
+  timeout = 5
+
+[server]
+  host = "example.com"
+`
+	if string(patch) != expected {
+		t.Errorf("Bad patch: expected\n%s\ngot\n%s", expected, patch)
+	}
+
+	tree, err := TreeFromMap(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := LoadBytes(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Merge("", changes.ToMap()); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := TreeFromMap(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tree.ToMap(), merged.ToMap()) {
+		t.Errorf("Bad merged patch: expected\n%v\ngot\n%v", merged.ToMap(), tree.ToMap())
+	}
+}
+
+func TestPatchUnchanged(t *testing.T) {
+	doc := map[string]interface{}{"a": int64(1), "t": map[string]interface{}{"b": "c"}}
+	patch, err := Patch(doc, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(patch)) != "" {
+		t.Errorf("expected an empty patch, got %q", patch)
+	}
+}
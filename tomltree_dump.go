@@ -0,0 +1,87 @@
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Dump parses the TOML-encoded data and returns a human-readable, indented
+// representation of the resulting tree, meant for debugging the parser. Each
+// line shows a key, the type of its value, the value itself for scalars, and
+// its position in the document:
+//
+//	server = table (1, 1)
+//	  host = string "localhost" (2, 1)
+//	  ports = array (3, 1)
+//	    [0] = int64 80
+//
+// Keys are sorted alphabetically.
+func Dump(data []byte) (string, error) {
+	tree, err := LoadBytes(data)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	dumpTree(&buf, tree, "")
+	return buf.String(), nil
+}
+
+func dumpTree(buf *bytes.Buffer, tree *Tree, indent string) {
+	keys := make([]string, 0, len(tree.values))
+	for k := range tree.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := quoteKeyIfNeeded(k)
+		switch node := tree.values[k].(type) {
+		case *Tree:
+			fmt.Fprintf(buf, "%s%s = table %s\n", indent, name, node.position)
+			dumpTree(buf, node, indent+"  ")
+		case []*Tree:
+			fmt.Fprintf(buf, "%s%s = array of tables %s\n", indent, name, tree.GetPosition(k))
+			for i, item := range node {
+				fmt.Fprintf(buf, "%s  [%d] = table %s\n", indent, i, item.position)
+				dumpTree(buf, item, indent+"    ")
+			}
+		case *tomlValue:
+			fmt.Fprintf(buf, "%s%s = %s %s\n", indent, name, dumpValue(node.value), node.position)
+			dumpElements(buf, node.value, indent+"  ")
+		}
+	}
+}
+
+// Returns the type of a value, followed by its representation for scalars
+func dumpValue(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		return "array"
+	case *Tree:
+		return "table"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case time.Time:
+		return "datetime " + v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf("%T %v", v, v)
+	}
+}
+
+// Writes the elements of arrays and inline tables nested in a value
+func dumpElements(buf *bytes.Buffer, value interface{}, indent string) {
+	switch v := value.(type) {
+	case []interface{}:
+		for i, item := range v {
+			if tv, ok := item.(*tomlValue); ok {
+				item = tv.value
+			}
+			fmt.Fprintf(buf, "%s[%d] = %s\n", indent, i, dumpValue(item))
+			dumpElements(buf, item, indent+"  ")
+		}
+	case *Tree:
+		dumpTree(buf, v, indent)
+	}
+}
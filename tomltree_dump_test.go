@@ -0,0 +1,51 @@
+package toml
+
+import (
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	doc := []byte(`title = "TOML"
+created = 1979-05-27T07:32:00Z
+
+[server]
+ports = [80, 443]
+enabled = true
+"max load" = 0.5
+
+[[products]]
+name = "Hammer"
+
+[[products]]
+point = { x = 1 }
+`)
+	expected := `created = datetime 1979-05-27T07:32:00Z (2, 1)
+products = array of tables (12, 1)
+  [0] = table (9, 1)
+    name = string "Hammer" (10, 1)
+  [1] = table (12, 1)
+    point = table (0, 0)
+      x = int64 1 (13, 11)
+server = table (4, 1)
+  enabled = bool true (6, 1)
+  "max load" = float64 0.5 (7, 1)
+  ports = array (5, 1)
+    [0] = int64 80
+    [1] = int64 443
+title = string "TOML" (1, 1)
+`
+	result, err := Dump(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != expected {
+		t.Errorf("Bad dump:\nexpected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, result)
+	}
+}
+
+func TestDumpError(t *testing.T) {
+	_, err := Dump([]byte("a = "))
+	if err == nil || err.Error() != "(1, 5): expecting a value" {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package toml
+
+// ImmutableTree is a read-only view of a parsed TOML document, as returned by
+// Decoder.DecodeImmutableInterned.
+//
+// The underlying tree is never exposed nor modified once the ImmutableTree has
+// been created, so an ImmutableTree and all the values it returns are safe for
+// concurrent use by multiple goroutines without locking or copying. Nested
+// tables are returned as *ImmutableTree and arrays of tables as
+// []*ImmutableTree. Arrays of values are returned as copies, so modifying them
+// has no effect on the tree.
+//
+// Keys are interned while decoding: each distinct key string is stored once,
+// however many tables define it. This saves memory for documents repeating
+// the same keys, such as long arrays of tables, and the memory is retained for
+// as long as the tree is.
+type ImmutableTree struct {
+	tree *Tree
+}
+
+// Position returns the position of the tree.
+func (t *ImmutableTree) Position() Position {
+	return t.tree.Position()
+}
+
+// Has returns a boolean indicating if the given key exists.
+func (t *ImmutableTree) Has(key string) bool {
+	return t.tree.Has(key)
+}
+
+// HasPath returns true if the given path of keys exists, false otherwise.
+func (t *ImmutableTree) HasPath(keys []string) bool {
+	return t.tree.HasPath(keys)
+}
+
+// Keys returns the keys of the toplevel tree (does not recurse).
+func (t *ImmutableTree) Keys() []string {
+	return t.tree.Keys()
+}
+
+// Get the value at key in the ImmutableTree, like Tree.Get.
+func (t *ImmutableTree) Get(key string) interface{} {
+	return immutableValue(t.tree.Get(key))
+}
+
+// GetPath returns the element in the tree indicated by 'keys', like
+// Tree.GetPath.
+func (t *ImmutableTree) GetPath(keys []string) interface{} {
+	return immutableValue(t.tree.GetPath(keys))
+}
+
+// GetPosition returns the position of the given key.
+func (t *ImmutableTree) GetPosition(key string) Position {
+	return t.tree.GetPosition(key)
+}
+
+// GetPositionPath returns the element in the tree indicated by 'keys'.
+func (t *ImmutableTree) GetPositionPath(keys []string) Position {
+	return t.tree.GetPositionPath(keys)
+}
+
+// ToMap recursively copies the tree into a map[string]interface{}, like
+// Tree.ToMap.
+func (t *ImmutableTree) ToMap() map[string]interface{} {
+	return t.tree.ToMap()
+}
+
+// String generates a human-readable representation of the tree, like
+// Tree.String.
+func (t *ImmutableTree) String() string {
+	return t.tree.String()
+}
+
+// Wraps the tables of a value returned by the underlying tree, and copies
+// its arrays
+func immutableValue(value interface{}) interface{} {
+	switch node := value.(type) {
+	case *Tree:
+		return &ImmutableTree{tree: node}
+	case []*Tree:
+		result := make([]*ImmutableTree, len(node))
+		for i, item := range node {
+			result[i] = &ImmutableTree{tree: item}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(node))
+		for i, item := range node {
+			result[i] = immutableValue(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// Replaces the keys of the tree and its subtrees by their first occurrence in
+// pool, adding the keys seen for the first time
+func (t *Tree) internKeys(pool map[string]string) {
+	values := make(map[string]interface{}, len(t.values))
+	for k, v := range t.values {
+		interned, ok := pool[k]
+		if !ok {
+			pool[k] = k
+			interned = k
+		}
+		values[interned] = v
+		internValueKeys(v, pool)
+	}
+	t.values = values
+}
+
+func internValueKeys(value interface{}, pool map[string]string) {
+	switch node := value.(type) {
+	case *Tree:
+		node.internKeys(pool)
+	case []*Tree:
+		for _, item := range node {
+			item.internKeys(pool)
+		}
+	case *tomlValue:
+		internValueKeys(node.value, pool)
+	case []interface{}:
+		for _, item := range node {
+			internValueKeys(item, pool)
+		}
+	}
+}
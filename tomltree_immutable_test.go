@@ -0,0 +1,132 @@
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+func decodeImmutable(t testing.TB, doc string) *ImmutableTree {
+	tree, err := NewDecoder(strings.NewReader(doc)).DecodeImmutableInterned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestDecodeImmutableInterned(t *testing.T) {
+	tree := decodeImmutable(t, "title = \"doc\"\nports = [80, 443]\n[server]\nhost = \"localhost\"\n"+
+		"[[users]]\nname = \"tom\"\n[[users]]\nname = \"ann\"\n")
+
+	if tree.Get("title") != "doc" || !tree.Has("server") || !tree.HasPath([]string{"server", "host"}) {
+		t.Errorf("bad tree: %v", tree)
+	}
+	server, ok := tree.Get("server").(*ImmutableTree)
+	if !ok || server.Get("host") != "localhost" || server.Position() != (Position{3, 1}) {
+		t.Errorf("expected an immutable table, got %#v", tree.Get("server"))
+	}
+	users, ok := tree.Get("users").([]*ImmutableTree)
+	if !ok || len(users) != 2 || users[1].Get("name") != "ann" {
+		t.Errorf("expected an array of immutable tables, got %#v", tree.Get("users"))
+	}
+	if tree.GetPath([]string{"users", "name"}) != "ann" {
+		t.Errorf("expected the last table of the array, got %v", tree.GetPath([]string{"users", "name"}))
+	}
+
+	ports := tree.Get("ports").([]interface{})
+	ports[0] = int64(8080)
+	if !reflect.DeepEqual(tree.Get("ports"), []interface{}{int64(80), int64(443)}) {
+		t.Errorf("modifying a returned array changed the tree: %v", tree.Get("ports"))
+	}
+
+	_, err := NewDecoder(strings.NewReader("a = ")).DecodeImmutableInterned()
+	if err == nil {
+		t.Error("expected a parsing error")
+	}
+}
+
+func TestDecodeImmutableInternedKeys(t *testing.T) {
+	tree := decodeImmutable(t, "[[users]]\nname = \"tom\"\n[[users]]\nname = \"ann\"\n")
+	users := tree.Get("users").([]*ImmutableTree)
+	first, second := users[0].Keys()[0], users[1].Keys()[0]
+	data := func(s *string) uintptr {
+		return (*reflect.StringHeader)(unsafe.Pointer(s)).Data
+	}
+	if first != "name" || data(&first) != data(&second) {
+		t.Errorf("expected both tables to share the interned key, got %q and %q", first, second)
+	}
+}
+
+func TestImmutableTreeConcurrentReads(t *testing.T) {
+	tree := decodeImmutable(t, "[server]\nhost = \"localhost\"\nports = [80, 443]\n"+
+		"[[users]]\nname = \"tom\"\n[[users]]\nname = \"ann\"\n")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if tree.GetPath([]string{"server", "host"}) != "localhost" {
+					t.Error("bad host")
+					return
+				}
+				for _, user := range tree.Get("users").([]*ImmutableTree) {
+					user.Get("name")
+					user.Keys()
+				}
+				tree.ToMap()
+				_ = tree.String()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func immutableBenchmarkDocument() []byte {
+	var buf bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&buf, "[[servers]]\nhostname = \"host-%d\"\nport_number = %d\nenabled = true\n", i, i)
+	}
+	return buf.Bytes()
+}
+
+// benchmarkRetained decodes documents while keeping them alive, and logs the
+// memory retained per document
+func benchmarkRetained(b *testing.B, decode func([]byte) (interface{}, error)) {
+	doc := immutableBenchmarkDocument()
+	retained := make([]interface{}, 0, b.N)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree, err := decode(doc)
+		if err != nil {
+			b.Fatal(err)
+		}
+		retained = append(retained, tree)
+	}
+	b.StopTimer()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	b.Logf("%d retained bytes/op", int64(after.HeapAlloc-before.HeapAlloc)/int64(b.N))
+	runtime.KeepAlive(retained)
+}
+
+func BenchmarkDecodePlain(b *testing.B) {
+	benchmarkRetained(b, func(doc []byte) (interface{}, error) {
+		return LoadBytes(doc)
+	})
+}
+
+func BenchmarkDecodeImmutableInterned(b *testing.B) {
+	benchmarkRetained(b, func(doc []byte) (interface{}, error) {
+		return NewDecoder(bytes.NewReader(doc)).DecodeImmutableInterned()
+	})
+}
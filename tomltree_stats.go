@@ -0,0 +1,59 @@
+package toml
+
+import (
+	"reflect"
+)
+
+// TreeStats counts the nodes of a document by kind, as returned by Stats.
+type TreeStats struct {
+	Tables int // tables, including inline tables and the tables of arrays of tables, but not the root table
+	Arrays int // arrays, including arrays of tables
+	// Scalars counts the other values by TOML type: "string", "integer",
+	// "float", "boolean" or "datetime", as in SchemaRule.Type.
+	Scalars map[string]int
+	// MaxDepth is the length of the longest path of a node, where each key
+	// and each array index counts as one level. Keys of the root table are
+	// at depth 1, and an empty document has a depth of 0.
+	MaxDepth int
+}
+
+// Stats walks a decoded document and counts its nodes. tree may be a *Tree,
+// an *ImmutableTree, or a value using the types documented on Tree.ToMap,
+// such as the result of decoding into a map[string]interface{}. Stats of any
+// other value are empty.
+func Stats(tree interface{}) TreeStats {
+	stats := TreeStats{Scalars: map[string]int{}}
+	switch node := tree.(type) {
+	case *Tree:
+		tree = node.ToMap()
+	case *ImmutableTree:
+		tree = node.ToMap()
+	}
+	table, _ := tree.(map[string]interface{})
+	for _, v := range table {
+		stats.add(v, 1)
+	}
+	return stats
+}
+
+func (s *TreeStats) add(value interface{}, depth int) {
+	if depth > s.MaxDepth {
+		s.MaxDepth = depth
+	}
+	if table, ok := value.(map[string]interface{}); ok {
+		s.Tables++
+		for _, v := range table {
+			s.add(v, depth+1)
+		}
+		return
+	}
+	// arrays may be typed slices, e.g. []map[string]interface{} or []int64
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice {
+		s.Arrays++
+		for i := 0; i < v.Len(); i++ {
+			s.add(v.Index(i).Interface(), depth+1)
+		}
+		return
+	}
+	s.Scalars[schemaType(value)]++
+}
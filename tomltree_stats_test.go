@@ -0,0 +1,52 @@
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	tree, err := Load(`
+title = "stats"
+ports = [80, 443]
+point = { x = 1.5, y = -2.0 }
+created = 1979-05-27T07:32:00Z
+
+[server]
+enabled = true
+[server.limits]
+max = [[1, 2], [3]]
+
+[[users]]
+name = "tom"
+[[users]]
+name = "ann"
+birthday = 1979-05-27
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := TreeStats{
+		Tables: 5,
+		Arrays: 5,
+		Scalars: map[string]int{
+			"string":   3,
+			"integer":  5,
+			"float":    2,
+			"boolean":  1,
+			"datetime": 2,
+		},
+		MaxDepth: 5,
+	}
+	if stats := Stats(tree); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Bad stats: expected\n%+v\ngot\n%+v", expected, stats)
+	}
+	if stats := Stats(tree.ToMap()); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Bad stats of a map: expected\n%+v\ngot\n%+v", expected, stats)
+	}
+
+	empty := TreeStats{Scalars: map[string]int{}}
+	if stats := Stats(map[string]interface{}{}); !reflect.DeepEqual(stats, empty) {
+		t.Errorf("Bad stats of an empty document: %+v", stats)
+	}
+}
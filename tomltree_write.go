@@ -47,9 +47,8 @@ func encodeMultilineTomlString(value string) string {
 		case '\\':
 			b.WriteString(`\`)
 		default:
-			intRr := uint16(rr)
-			if intRr < 0x001F {
-				b.WriteString(fmt.Sprintf("\\u%0.4X", intRr))
+			if isControlRune(rr) {
+				b.WriteString(fmt.Sprintf("\\u%04X", rr))
 			} else {
 				b.WriteRune(rr)
 			}
@@ -58,6 +57,28 @@ func encodeMultilineTomlString(value string) string {
 	return b.String()
 }
 
+// Control characters must be escaped in basic strings. Those without a short
+// escape sequence are written as \uXXXX.
+func isControlRune(r rune) bool {
+	return r < 0x20 || r == 0x7F
+}
+
+// Reports whether a string is more readable as a literal string, which is
+// written as is: it must contain characters which a basic string escapes,
+// such as the backslashes of Windows paths and regular expressions, but no
+// single quote nor control character, which literal strings cannot hold.
+func preferLiteralString(value string) bool {
+	if !strings.ContainsAny(value, `\"`) {
+		return false
+	}
+	for _, r := range value {
+		if r == '\'' || isControlRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
 // Encodes a string to a TOML-compliant string value
 func encodeTomlString(value string) string {
 	var b bytes.Buffer
@@ -79,9 +100,8 @@ func encodeTomlString(value string) string {
 		case '\\':
 			b.WriteString(`\\`)
 		default:
-			intRr := uint16(rr)
-			if intRr < 0x001F {
-				b.WriteString(fmt.Sprintf("\\u%0.4X", intRr))
+			if isControlRune(rr) {
+				b.WriteString(fmt.Sprintf("\\u%04X", rr))
 			} else {
 				b.WriteRune(rr)
 			}
@@ -90,7 +110,7 @@ func encodeTomlString(value string) string {
 	return b.String()
 }
 
-func tomlValueStringRepresentation(v interface{}, indent string, arraysOneElementPerLine bool) (string, error) {
+func tomlValueStringRepresentation(v interface{}, indent string, arrayWrap int) (string, error) {
 	// this interface check is added to dereference the change made in the writeTo function.
 	// That change was made to allow this function to see formatting options.
 	tv, ok := v.(*tomlValue)
@@ -105,6 +125,8 @@ func tomlValueStringRepresentation(v interface{}, indent string, arraysOneElemen
 		return strconv.FormatUint(value, 10), nil
 	case int64:
 		return strconv.FormatInt(value, 10), nil
+	case Integer:
+		return value.String(), nil
 	case float64:
 		// Ensure a round float does contain a decimal point. Otherwise feeding
 		// the output back to the parser would convert to an integer.
@@ -116,10 +138,13 @@ func tomlValueStringRepresentation(v interface{}, indent string, arraysOneElemen
 		if tv.multiline {
 			return "\"\"\"\n" + encodeMultilineTomlString(value) + "\"\"\"", nil
 		}
+		if preferLiteralString(value) {
+			return "'" + value + "'", nil
+		}
 		return "\"" + encodeTomlString(value) + "\"", nil
 	case []byte:
 		b, _ := v.([]byte)
-		return tomlValueStringRepresentation(string(b), indent, arraysOneElementPerLine)
+		return tomlValueStringRepresentation(string(b), indent, arrayWrap)
 	case bool:
 		if value {
 			return "true", nil
@@ -127,8 +152,17 @@ func tomlValueStringRepresentation(v interface{}, indent string, arraysOneElemen
 		return "false", nil
 	case time.Time:
 		return value.Format(time.RFC3339), nil
+	case LocalDate:
+		return value.String(), nil
+	case LocalTime:
+		return value.String(), nil
+	case LocalDateTime:
+		return value.String(), nil
 	case nil:
 		return "", nil
+	case *Tree:
+		// only found in arrays mixing inline tables with other values
+		return inlineTableStringRepresentation(value, indent, arrayWrap)
 	}
 
 	rv := reflect.ValueOf(v)
@@ -137,13 +171,13 @@ func tomlValueStringRepresentation(v interface{}, indent string, arraysOneElemen
 		var values []string
 		for i := 0; i < rv.Len(); i++ {
 			item := rv.Index(i).Interface()
-			itemRepr, err := tomlValueStringRepresentation(item, indent, arraysOneElementPerLine)
+			itemRepr, err := tomlValueStringRepresentation(item, indent, arrayWrap)
 			if err != nil {
 				return "", err
 			}
 			values = append(values, itemRepr)
 		}
-		if arraysOneElementPerLine && len(values) > 1 {
+		if arrayWrap > 0 && len(values) > arrayWrap {
 			stringBuffer := bytes.Buffer{}
 			valueIndent := indent + `  ` // TODO: move that to a shared encoder state
 
@@ -165,6 +199,23 @@ func tomlValueStringRepresentation(v interface{}, indent string, arraysOneElemen
 	return "", fmt.Errorf("unsupported value type %T: %v", v, v)
 }
 
+func inlineTableStringRepresentation(t *Tree, indent string, arrayWrap int) (string, error) {
+	keys := t.Keys()
+	sort.Strings(keys)
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		repr, err := tomlValueStringRepresentation(t.values[k], indent, arrayWrap)
+		if err != nil {
+			return "", err
+		}
+		fields[i] = quoteKeyIfNeeded(k) + " = " + repr
+	}
+	if len(fields) == 0 {
+		return "{}", nil
+	}
+	return "{ " + strings.Join(fields, ", ") + " }", nil
+}
+
 func getTreeArrayLine(trees []*Tree) (line int) {
 	// get lowest line number that is not 0
 	for _, tv := range trees {
@@ -254,11 +305,11 @@ func sortAlphabetical(t *Tree) (vals []sortNode) {
 	return vals
 }
 
-func (t *Tree) writeTo(w io.Writer, indent, keyspace string, bytesCount int64, arraysOneElementPerLine bool) (int64, error) {
-	return t.writeToOrdered(w, indent, keyspace, bytesCount, arraysOneElementPerLine, OrderAlphabetical)
+func (t *Tree) writeTo(w io.Writer, indent, keyspace string, bytesCount int64, arrayWrap int) (int64, error) {
+	return t.writeToOrdered(w, indent, keyspace, bytesCount, arrayWrap, OrderAlphabetical)
 }
 
-func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount int64, arraysOneElementPerLine bool, ord marshalOrder) (int64, error) {
+func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount int64, arrayWrap int, ord marshalOrder) (int64, error) {
 	var orderedVals []sortNode
 
 	switch ord {
@@ -307,7 +358,7 @@ func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount i
 				if err != nil {
 					return bytesCount, err
 				}
-				bytesCount, err = node.writeToOrdered(w, indent+"  ", combinedKey, bytesCount, arraysOneElementPerLine, ord)
+				bytesCount, err = node.writeToOrdered(w, indent+"  ", combinedKey, bytesCount, arrayWrap, ord)
 				if err != nil {
 					return bytesCount, err
 				}
@@ -319,7 +370,7 @@ func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount i
 						return bytesCount, err
 					}
 
-					bytesCount, err = subTree.writeToOrdered(w, indent+"  ", combinedKey, bytesCount, arraysOneElementPerLine, ord)
+					bytesCount, err = subTree.writeToOrdered(w, indent+"  ", combinedKey, bytesCount, arrayWrap, ord)
 					if err != nil {
 						return bytesCount, err
 					}
@@ -332,7 +383,7 @@ func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount i
 				return bytesCount, fmt.Errorf("invalid value type at %s: %T", k, t.values[k])
 			}
 
-			repr, err := tomlValueStringRepresentation(v, indent, arraysOneElementPerLine)
+			repr, err := tomlValueStringRepresentation(v, indent, arrayWrap)
 			if err != nil {
 				return bytesCount, err
 			}
@@ -380,7 +431,7 @@ func writeStrings(w io.Writer, s ...string) (int, error) {
 // WriteTo encode the Tree as Toml and writes it to the writer w.
 // Returns the number of bytes written in case of success, or an error if anything happened.
 func (t *Tree) WriteTo(w io.Writer) (int64, error) {
-	return t.writeTo(w, "", "", 0, false)
+	return t.writeTo(w, "", "", 0, 0)
 }
 
 // ToTomlString generates a human-readable representation of the current tree.
@@ -411,6 +462,7 @@ func (t *Tree) String() string {
 //	* string
 //	* uint64
 //	* time.Time
+//	* LocalDate, LocalTime and LocalDateTime
 //	* map[string]interface{} (where interface{} is any of this list)
 //	* []interface{} (where interface{} is any of this list)
 func (t *Tree) ToMap() map[string]interface{} {
@@ -427,8 +479,112 @@ func (t *Tree) ToMap() map[string]interface{} {
 		case *Tree:
 			result[k] = node.ToMap()
 		case *tomlValue:
-			result[k] = node.value
+			result[k] = arrayToMaps(node.value)
 		}
 	}
 	return result
 }
+
+// Converts the inline tables of arrays mixing types to maps, as done by ToMap
+func arrayToMaps(value interface{}) interface{} {
+	switch node := value.(type) {
+	case *Tree:
+		return node.ToMap()
+	case []*Tree:
+		array := make([]interface{}, len(node))
+		for i, item := range node {
+			array[i] = item.ToMap()
+		}
+		return array
+	case []interface{}:
+		array := make([]interface{}, len(node))
+		for i, item := range node {
+			array[i] = arrayToMaps(item)
+		}
+		return array
+	default:
+		return value
+	}
+}
+
+// ToJSONCompatible recursively converts the date and time values of tree,
+// such as the result of Tree.ToMap, to strings, so that it can be encoded
+// with encoding/json. Offset date-times are formatted as RFC 3339, and local
+// dates, times and date-times as in TOML. Trees are converted with ToMap.
+// Other values are left as is.
+func ToJSONCompatible(tree interface{}) interface{} {
+	switch node := tree.(type) {
+	case *Tree:
+		return ToJSONCompatible(node.ToMap())
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(node))
+		for k, v := range node {
+			result[k] = ToJSONCompatible(v)
+		}
+		return result
+	case []interface{}:
+		array := make([]interface{}, len(node))
+		for i, item := range node {
+			array[i] = ToJSONCompatible(item)
+		}
+		return array
+	case []map[string]interface{}:
+		array := make([]interface{}, len(node))
+		for i, item := range node {
+			array[i] = ToJSONCompatible(item)
+		}
+		return array
+	case time.Time:
+		return node.Format(time.RFC3339Nano)
+	case LocalDate:
+		return node.String()
+	case LocalTime:
+		return node.String()
+	case LocalDateTime:
+		return node.String()
+	default:
+		return tree
+	}
+}
+
+// toFlatMap recursively generates a single-level map whose keys are the full
+// dotted paths of the tree's values. Segments which are not valid bare keys
+// are quoted. Arrays of tables are kept as arrays of flat maps relative to
+// each table.
+func (t *Tree) toFlatMap() map[string]interface{} {
+	result := map[string]interface{}{}
+	t.flattenInto(result, "")
+	return result
+}
+
+func (t *Tree) flattenInto(result map[string]interface{}, prefix string) {
+	for k, v := range t.values {
+		key := prefix + quoteKeyIfNeeded(k)
+		switch node := v.(type) {
+		case []*Tree:
+			var array []interface{}
+			for _, item := range node {
+				array = append(array, item.toFlatMap())
+			}
+			result[key] = array
+		case *Tree:
+			node.flattenInto(result, key+".")
+		case *tomlValue:
+			result[key] = arrayToMaps(node.value)
+		}
+	}
+}
+
+// quoteKeyIfNeeded returns key as a basic string if it cannot be written as a
+// bare key.
+func quoteKeyIfNeeded(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for _, r := range key {
+		if !isValidBareChar(r) {
+			return "\"" + encodeTomlString(key) + "\""
+		}
+	}
+	return key
+}
@@ -2,6 +2,7 @@ package toml
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -294,6 +295,29 @@ func TestTreeWriteToMapWithArrayOfInlineTables(t *testing.T) {
 	testMaps(t, treeMap, expected)
 }
 
+func TestToJSONCompatible(t *testing.T) {
+	tree, err := Load(`created = 1979-05-27T07:32:00.5-08:00
+dates = [1979-05-27, 07:32:00]
+[server]
+started = 1979-05-27T07:32:00
+port = 8080
+[[users]]
+birthday = 1979-05-27
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(ToJSONCompatible(tree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"created":"1979-05-27T07:32:00.5-08:00","dates":["1979-05-27","07:32:00"],` +
+		`"server":{"port":8080,"started":"1979-05-27T07:32:00"},"users":[{"birthday":"1979-05-27"}]}`
+	if string(encoded) != expected {
+		t.Errorf("expected %s, got %s", expected, encoded)
+	}
+}
+
 func TestTreeWriteToFloat(t *testing.T) {
 	tree, err := Load(`a = 3.0`)
 	if err != nil {
@@ -327,6 +351,37 @@ c = nan`
 	}
 }
 
+func TestTreeWriteToEscapedString(t *testing.T) {
+	for value, encoded := range map[string]string{
+		"tab\tnewline\n":              `"tab\tnewline\n"`,
+		`say "hi"`:                    `'say "hi"'`,
+		`C:\path`:                     `'C:\path'`,
+		`it's C:\path`:                `"it's C:\\path"`,
+		"C:\\path\t":                  `"C:\\path\t"`,
+		"caf\u00e9 \u65e5\u672c":      "\"caf\u00e9 \u65e5\u672c\"",
+		"astral \U0001F600\U00010010": "\"astral \U0001F600\U00010010\"",
+		"nul\x00 us\x1f del\x7f":      `"nul\u0000 us\u001F del\u007F"`,
+	} {
+		tree := newTree()
+		tree.Set("a", value)
+		str, err := tree.ToTomlString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "a = " + encoded + "\n"; str != expected {
+			t.Errorf("Expected %q, got %q", expected, str)
+		}
+
+		loaded, err := Load(str)
+		if err != nil {
+			t.Fatalf("%q: %s", str, err)
+		}
+		if got := loaded.Get("a"); got != value {
+			t.Errorf("Round trip of %q gave %q", value, got)
+		}
+	}
+}
+
 func BenchmarkTreeToTomlString(b *testing.B) {
 	toml, err := Load(sampleHard)
 	if err != nil {